@@ -0,0 +1,96 @@
+//go:build unix
+
+// Command rbtpeer runs a single peer (seeder, baseline provider or leecher) of a test swarm in a process of its own,
+// controlled by the test through a local control socket (see utils.PeerProcess):
+//
+//	rbtpeer -role leecher -data-dir ./leecher0 -torrent test.torrent -port 6000 -control 127.0.0.1:7000
+//
+// GET /stats returns the state of the torrent as JSON (utils.PeerStats), and POST /download starts downloading it.
+// The peer shuts down cleanly on SIGTERM or SIGINT.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"rbtValidation/utils"
+	"syscall"
+	"time"
+
+	rbt "github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"golang.org/x/time/rate"
+)
+
+func main() {
+	roleName := flag.String("role", "leecher", `one of "seeder", "baseline_provider" or "leecher"`)
+	dataDir := flag.String("data-dir", ".", "data directory, holding the complete file for a seeder or baseline provider")
+	torrentFile := flag.String("torrent", "", "path to the .torrent file to share")
+	port := flag.Int("port", 0, "listen port, any free one if zero")
+	uploadRate := flag.Float64("upload-rate", 0, "upload rate limit in bytes per second, unlimited if zero")
+	downloadRate := flag.Float64("download-rate", 0, "download rate limit in bytes per second, unlimited if zero")
+	control := flag.String("control", "", "address to serve the control socket on")
+	flag.Parse()
+
+	role, err := utils.ParseRole(*roleName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	metaInfo, err := metainfo.LoadFromFile(*torrentFile)
+	if err != nil {
+		log.Fatalf("loading torrent: %v", err)
+	}
+	listener, err := net.Listen("tcp", *control)
+	if err != nil {
+		log.Fatalf("listening for control: %v", err)
+	}
+
+	config := utils.PeerConfig(role, *dataDir, *port)
+	if *uploadRate != 0 {
+		config.UploadRateLimiter = rate.NewLimiter(rate.Limit(*uploadRate), utils.DefaultChunkSize)
+	}
+	if *downloadRate != 0 {
+		config.DownloadRateLimiter = rate.NewLimiter(rate.Limit(*downloadRate), utils.DefaultChunkSize)
+	}
+	client, err := rbt.NewClient(config)
+	if err != nil {
+		log.Fatalf("creating client: %v", err)
+	}
+	torrent, err := client.AddTorrent(metaInfo)
+	if err != nil {
+		log.Fatalf("adding torrent: %v", err)
+	}
+	torrent.SmallIntervalAllowed = true
+	<-torrent.GotInfo()
+	log.Printf("%s listening on port %d, %d of %d bytes complete", role, client.LocalPort(), torrent.BytesCompleted(), torrent.Length())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(utils.StatsPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(utils.PeerStats{
+			Sample: utils.SampleTorrent(torrent, time.Now()),
+			Role:   role.Name(),
+			Port:   client.LocalPort(),
+			Length: torrent.Length(),
+		})
+	})
+	mux.HandleFunc(utils.DownloadPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		log.Printf("Downloading")
+		torrent.DownloadAll()
+	})
+	go http.Serve(listener, mux)
+
+	// Shut down cleanly when asked to, a SIGKILL is the way to simulate a crash
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Printf("Received %v, uploaded %d bytes, downloaded %d bytes", sig, torrent.UploadedBytes(), torrent.DownloadedBytes())
+	client.Close()
+}
@@ -7,6 +7,8 @@ replace github.com/anacrolix/torrent => ../cpsc416_GroupProject_ReliableBT
 require (
 	github.com/anacrolix/torrent v1.47.1-0.20221102120345-c63f7e1bd720
 	github.com/stretchr/testify v1.8.1
+	golang.org/x/time v0.0.0-20220609170525-579cf78fd858
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -74,6 +76,4 @@ require (
 	golang.org/x/net v0.7.0 // indirect
 	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4 // indirect
 	golang.org/x/sys v0.5.0 // indirect
-	golang.org/x/time v0.0.0-20220609170525-579cf78fd858 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,2 +0,0 @@
-cd ../reliableBT-tracker
-bash restart.sh
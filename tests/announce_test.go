@@ -1,148 +1,85 @@
 package tests
 
 import (
-	"os"
+	"rbtValidation/tracker"
 	"rbtValidation/utils"
 	"testing"
-
-	rbt "github.com/anacrolix/torrent"
+	"time"
 )
 
 // Test whether periodic announcement is made from each peer to the tracker.
-// This test requires Wireshark to be capturing on loopback and observe on the periodic requests. Each peer should have an announce per 1s.
+// The tracker records every announce it receives, each peer should have an announce per 1s.
 func TestBasicAnnounce(t *testing.T) {
-	// Create a seeder
-	seederConfig := SeederConfig(0, 0)
-	utils.CreateDir(t, seederConfig.DataDir)
-	seeder, _ := rbt.NewClient(seederConfig)
-	defer seeder.Close()
-	defer os.RemoveAll(seederConfig.DataDir)
-
-	// Create a test file within the seeder dir and add it to the seeder client
-	metaInfo := utils.CreateFileAndMetaInfo(t, []string{seederConfig.DataDir}, utils.TestFileName, 2e9, [][]string{{utils.TestTrackerAnnounceUrl}})
-	seederTorrent, err := seeder.AddTorrent(&metaInfo)
-	seederTorrent.SmallIntervalAllowed = true
-	utils.TestSeederInitial(t, seederTorrent, err)
-
-	// Create a leecher
-	leecherConfig := LeecherConfig(0, 0)
-	utils.CreateDir(t, leecherConfig.DataDir)
-	leecher, _ := rbt.NewClient(leecherConfig)
-	defer leecher.Close()
-	defer os.RemoveAll(leecherConfig.DataDir)
-
-	// Also attach the metaInfo to the leecher
-	leecherTorrent, _ := leecher.AddTorrent(&metaInfo)
-	leecherTorrent.SmallIntervalAllowed = true
-	<-leecherTorrent.GotInfo()
+	// Create a seeder and a leecher
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{FileSize: 2e9, Seeders: 1, Leechers: 1, Virtual: true, SmallInterval: true})
 
 	// Wait until transfer is complete
-	leecherTorrent.DownloadAll()
-	leecher.WaitAll()
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
 
 	// Verify baseline provider
-	utils.VerifyBaselineProvider(t, []*rbt.Torrent{seederTorrent, leecherTorrent}, nil)
-
-	// Verify file content equality
-	utils.VerifyFileContent(t, utils.TestFileName, seederConfig.DataDir, []string{leecherConfig.DataDir})
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Seeder, utils.Leecher), nil)
+
+	// Verify file content
+	utils.VerifyVirtualContent(t, swarm.Storages(utils.Leecher))
+
+	// Keep announcing for a few more intervals, so even a quick transfer leaves enough announces to judge
+	time.Sleep(4 * tracker.DefaultInterval)
+
+	// Verify each peer announced once per interval (SmallIntervalAllowed lifts the 1-minute minimum)
+	infoHash := swarm.MetaInfo.HashInfoBytes()
+	utils.LogAnnounces(t, swarm.Tracker, infoHash)
+	var ports []int
+	for _, p := range swarm.Peers(utils.Seeder, utils.Leecher) {
+		ports = append(ports, p.Client.LocalPort())
+	}
+	utils.VerifyAnnounceCadence(t, swarm.Tracker, infoHash, ports, tracker.DefaultInterval, 500*time.Millisecond)
 }
 
 // Test whether baseline provider announces itself to the tracker, and is then promoted to other peers.
 func TestBaselineProviderAnnounce(t *testing.T) {
-	// Create a seeder
-	seederConfig := SeederConfig(0, 3000)
-	utils.CreateDir(t, seederConfig.DataDir)
-	seeder, _ := rbt.NewClient(seederConfig)
-	defer seeder.Close()
-	defer os.RemoveAll(seederConfig.DataDir)
-
-	// Create a baseline provider (PORT 4000 is a known trusted source by the tracker)
-	baselineProviderPort := 4000
-	baselineProviderConfig := BaselineProviderConfig(0, baselineProviderPort)
-	utils.CreateDir(t, baselineProviderConfig.DataDir)
-	baselineProvider, _ := rbt.NewClient(baselineProviderConfig)
-	defer baselineProvider.Close()
-	defer os.RemoveAll(baselineProviderConfig.DataDir)
-
-	// Create a test file within the seeder and baseline provider dir and add it to both clients
-	metaInfo := utils.CreateFileAndMetaInfo(t, []string{seederConfig.DataDir, baselineProviderConfig.DataDir}, utils.TestFileName, 2e9, [][]string{{utils.TestTrackerAnnounceUrl}})
-	seederTorrent, err := seeder.AddTorrent(&metaInfo)
-	seederTorrent.SmallIntervalAllowed = true
-	utils.TestSeederInitial(t, seederTorrent, err)
-
-	baselineProviderTorrent, err := baselineProvider.AddTorrent(&metaInfo)
-	baselineProviderTorrent.SmallIntervalAllowed = true
-	utils.TestSeederInitial(t, baselineProviderTorrent, err)
-
-	// Create a leecher
-	leecherConfig := LeecherConfig(0, 4030)
-	utils.CreateDir(t, leecherConfig.DataDir)
-	leecher, _ := rbt.NewClient(leecherConfig)
-	defer leecher.Close()
-	defer os.RemoveAll(leecherConfig.DataDir)
-
-	// Also attach the metaInfo to the leecher
-	leecherTorrent, _ := leecher.AddTorrent(&metaInfo)
-	leecherTorrent.SmallIntervalAllowed = true
-	<-leecherTorrent.GotInfo()
+	// Create a seeder, a baseline provider (on a free port, trusted by the tracker) and a leecher
+	baselineProviderPort := utils.FreePort(t)
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              2e9,
+		Virtual:               true,
+		Seeders:               1,
+		BaselineProviderPorts: []int{baselineProviderPort},
+		Leechers:              1,
+		SmallInterval:         true,
+	})
 
 	// Wait until transfer is complete
-	leecherTorrent.DownloadAll()
-	leecher.WaitAll()
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
 
 	// Verify baseline provider (baseline provider should not get itself as baseline provider)
-	utils.VerifyBaselineProvider(t, []*rbt.Torrent{seederTorrent, leecherTorrent}, []int{baselineProviderPort})
-	utils.VerifyBaselineProvider(t, []*rbt.Torrent{baselineProviderTorrent}, []int{})
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Seeder, utils.Leecher), []int{baselineProviderPort})
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.BaselineProvider), []int{})
 
-	// Verify file content equality
-	utils.VerifyFileContent(t, utils.TestFileName, seederConfig.DataDir, []string{leecherConfig.DataDir})
+	// Verify file content
+	utils.VerifyVirtualContent(t, swarm.Storages(utils.Leecher))
 }
 
 // Test whether a fake baseline provider will be identified by the tracker and thus not promoted to other peers.
 func TestFakeBaselineProviderAnnounce(t *testing.T) {
-	// Create a seeder
-	seederConfig := SeederConfig(0, 0)
-	utils.CreateDir(t, seederConfig.DataDir)
-	seeder, _ := rbt.NewClient(seederConfig)
-	defer seeder.Close()
-	defer os.RemoveAll(seederConfig.DataDir)
-
-	// Create a "fraud" baseline provider (PORT 4500 is a NOT a known trusted source by the tracker)
-	baselineProviderConfig := BaselineProviderConfig(0, 4500)
-	utils.CreateDir(t, baselineProviderConfig.DataDir)
-	baselineProvider, _ := rbt.NewClient(baselineProviderConfig)
-	defer baselineProvider.Close()
-	defer os.RemoveAll(baselineProviderConfig.DataDir)
-
-	// Create a test file within the seeder and baseline provider dir and add it to both clients
-	metaInfo := utils.CreateFileAndMetaInfo(t, []string{seederConfig.DataDir, baselineProviderConfig.DataDir}, utils.TestFileName, 2e9, [][]string{{utils.TestTrackerAnnounceUrl}})
-	seederTorrent, err := seeder.AddTorrent(&metaInfo)
-	seederTorrent.SmallIntervalAllowed = true
-	utils.TestSeederInitial(t, seederTorrent, err)
-
-	baselineProviderTorrent, err := baselineProvider.AddTorrent(&metaInfo)
-	baselineProviderTorrent.SmallIntervalAllowed = true
-	utils.TestSeederInitial(t, baselineProviderTorrent, err)
-
-	// Create a leecher
-	leecherConfig := LeecherConfig(0, 0)
-	utils.CreateDir(t, leecherConfig.DataDir)
-	leecher, _ := rbt.NewClient(leecherConfig)
-	defer leecher.Close()
-	defer os.RemoveAll(leecherConfig.DataDir)
-
-	// Also attach the metaInfo to the leecher
-	leecherTorrent, _ := leecher.AddTorrent(&metaInfo)
-	leecherTorrent.SmallIntervalAllowed = true
-	<-leecherTorrent.GotInfo()
+	// Create a seeder, a "fraud" baseline provider (on a free port, NOT trusted by the tracker) and a leecher
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:                  2e9,
+		Virtual:                   true,
+		Seeders:                   1,
+		FakeBaselineProviderPorts: []int{utils.FreePort(t)},
+		Leechers:                  1,
+		SmallInterval:             true,
+	})
 
 	// Wait until transfer is complete
-	leecherTorrent.DownloadAll()
-	leecher.WaitAll()
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
 
 	// Verify baseline provider (as bad actors are ignored, no one should have this info)
-	utils.VerifyBaselineProvider(t, []*rbt.Torrent{seederTorrent, leecherTorrent, baselineProviderTorrent}, []int{})
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Seeder, utils.Leecher, utils.BaselineProvider), []int{})
 
-	// Verify file content equality
-	utils.VerifyFileContent(t, utils.TestFileName, seederConfig.DataDir, []string{leecherConfig.DataDir})
+	// Verify file content
+	utils.VerifyVirtualContent(t, swarm.Storages(utils.Leecher))
 }
@@ -2,7 +2,6 @@ package tests
 
 import (
 	"fmt"
-	"os"
 	"rbtValidation/utils"
 	"testing"
 	"time"
@@ -15,141 +14,106 @@ import (
 // kills the seeder, starts the baseline provider (which starts with the complete file).
 // Expectation: the leecher should be able to finish the rest of the download with the baseline provider.
 func TestSeederWaitAndDieHandOverToBaselineProvider(t *testing.T) {
-	// Create a seeder
-	seederConfig := SeederConfig(0, 0)
-	utils.CreateDir(t, seederConfig.DataDir)
-	seederConfig.UploadRateLimiter = utils.SmallRateLimiter
-	seeder, _ := rbt.NewClient(seederConfig)
-	defer os.RemoveAll(seederConfig.DataDir)
-
-	// Create a baseline provider (PORT 4000 is a known trusted source by the tracker)
-	baselineProviderPort := 4000
-	baselineProviderConfig := BaselineProviderConfig(0, baselineProviderPort)
-	utils.CreateDir(t, baselineProviderConfig.DataDir)
-
-	// Create a test file within the seeder and baseline provider dir and add it to both clients
-	utils.CreateFilesInDirs(t, []string{seederConfig.DataDir, baselineProviderConfig.DataDir}, utils.TestFileName, 1e7)
-	metaInfo := utils.CreateMetaInfo(t, seederConfig.DataDir, utils.TestFileName, [][]string{{utils.TestTrackerAnnounceUrl}})
-	trackerlessMetaInfo := utils.CreateMetaInfo(t, seederConfig.DataDir, utils.TestFileName, [][]string{})
-	seederTorrent, err := seeder.AddTorrent(&metaInfo)
-	seederTorrent.SmallIntervalAllowed = true
-	utils.TestSeederInitial(t, seederTorrent, err)
-	baselineProvider, _ := rbt.NewClient(baselineProviderConfig)
-	defer baselineProvider.Close()
-	defer os.RemoveAll(baselineProviderConfig.DataDir)
-
-	// Create a leecher
-	leecherConfig := LeecherConfig(0, 0)
-	utils.CreateDir(t, leecherConfig.DataDir)
-	leecher, _ := rbt.NewClient(leecherConfig)
-	defer leecher.Close()
-	defer os.RemoveAll(leecherConfig.DataDir)
-
-	// Also attach the metaInfo to the leecher
-	leecherTorrent, _ := leecher.AddTorrent(&metaInfo)
-	leecherTorrent.SmallIntervalAllowed = true
-	<-leecherTorrent.GotInfo()
-
-	leecherTorrent.DownloadAll()
+	// Create a throttled seeder and a leecher, keeping track of where the data the leecher receives comes from
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize: 1e7,
+		Seeders:  1,
+		Leechers: 1,
+		Configure: func(p *utils.Peer) {
+			if p.Role == utils.Seeder {
+				p.Config.UploadRateLimiter = utils.SmallRateLimiter
+			}
+		},
+		SmallInterval: true,
+	})
+	seeder, leecher := swarm.Seeder(0), swarm.Leecher(0)
+
+	// Sample the transfer of every torrent throughout the test
+	metrics := swarm.StartMetrics(utils.DefaultSampleInterval)
+
+	swarm.DownloadAll()
 
 	// Sleep for 3 seconds and close seeder
 	time.Sleep(3 * time.Second)
-	seederUploadedBytes := seederTorrent.UploadedBytes()
+	seederUploadedBytes := seeder.Torrent.UploadedBytes()
 	fmt.Println("Seeder Uploaded Bytes: ", seederUploadedBytes)
-	fmt.Println("Leecher Downloaded Bytes: ", seederTorrent.DownloadedBytes())
+	fmt.Println("Leecher Downloaded Bytes: ", seeder.Torrent.DownloadedBytes())
 
 	seeder.Close()
+	seederDeath := metrics.Mark("seeder killed")
 
-	// Start baseline provider
-	baselineProviderTorrent, err := baselineProvider.AddTorrent(&trackerlessMetaInfo)
-	baselineProviderTorrent.SmallIntervalAllowed = true
-	utils.TestSeederInitial(t, baselineProviderTorrent, err)
+	// Start baseline provider (on a free port, trusted by the tracker), which starts with the complete file
+	baselineProvider := swarm.AddTrackerlessPeer(utils.BaselineProvider, 0)
 
 	// Let it process that it has the complete file,
 	// So it will promote itself to the tracker as a complete baseline provider right away
 	time.Sleep(3 * time.Second)
-	baselineProviderTorrent.AddTrackers([][]string{{utils.TestTrackerAnnounceUrl}})
+	swarm.AddTrackers(baselineProvider)
 
 	// Wait until transfer is complete
-	leecher.WaitAll()
-	baselineProviderUploadedBytes := baselineProviderTorrent.UploadedBytes()
+	swarm.WaitLeechers()
+	baselineProviderUploadedBytes := baselineProvider.Torrent.UploadedBytes()
 	fmt.Println("Baseline Provider Uploaded Bytes: ", baselineProviderUploadedBytes)
-	fmt.Println("Baseline Provider Downloaded Bytes: ", baselineProviderTorrent.DownloadedBytes())
+	fmt.Println("Baseline Provider Downloaded Bytes: ", baselineProvider.Torrent.DownloadedBytes())
 
 	// Verify that baseline provider does contribute to the leecher
 	if seederUploadedBytes < 2e9 {
 		require.NotZero(t, baselineProviderUploadedBytes)
 	}
 
+	// Verify that the baseline provider supplied everything the leecher received after the seeder died
+	utils.VerifyAttribution(t, swarm.Ledger, leecher.String(), leecher.Torrent.BytesCompleted())
+	if seederUploadedBytes < 1e7 {
+		utils.VerifyContribution(t, swarm.Ledger, leecher.String(), []string{baselineProvider.String()}, seederDeath, 0.99)
+	}
+
+	// Measure how quickly the baseline provider took over after the seeder died
+	metrics.Stop()
+	metrics.LogSummary()
+	if takeover, ok := metrics.TimeUntil(baselineProvider.String(), seederDeath, func(s utils.Sample) bool { return s.Uploaded > 0 }); ok {
+		t.Logf("Baseline provider started uploading %v after the seeder died", takeover.Round(time.Millisecond))
+	}
+	if known, ok := metrics.TimeUntil(leecher.String(), seederDeath, func(s utils.Sample) bool { return s.BaselineProvider != "" }); ok {
+		t.Logf("Leecher learnt about the baseline provider %v after the seeder died", known.Round(time.Millisecond))
+	}
+
 	// Verify baseline provider (baseline provider should not get itself as baseline provider, but everyone else should)
-	utils.VerifyBaselineProvider(t, []*rbt.Torrent{leecherTorrent}, []int{baselineProviderPort})
-	utils.VerifyBaselineProvider(t, []*rbt.Torrent{baselineProviderTorrent}, []int{})
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Leecher), []int{baselineProvider.Client.LocalPort()})
+	utils.VerifyBaselineProvider(t, []*rbt.Torrent{baselineProvider.Torrent}, []int{})
 
 	// Verify file content equality
-	utils.VerifyFileContent(t, utils.TestFileName, seederConfig.DataDir, []string{leecherConfig.DataDir})
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
 }
 
 // Starts with a seeder and an empty leecher, runs for 3s,
 // starts the baseline provider (which starts with the complete file).
 // Expectation: the leecher should be able to finish the rest of the download with both the seeder and the baseline provider.
 func TestSeederWaitAndBaselineProviderJoin(t *testing.T) {
-	// Create a seeder
-	seederConfig := SeederConfig(0, 0)
-	utils.CreateDir(t, seederConfig.DataDir)
-	seeder, _ := rbt.NewClient(seederConfig)
-	defer os.RemoveAll(seederConfig.DataDir)
-
-	// Create a baseline provider (PORT 4000 is a known trusted source by the tracker)
-	baselineProviderPort := 4000
-	baselineProviderConfig := BaselineProviderConfig(0, baselineProviderPort)
-	utils.CreateDir(t, baselineProviderConfig.DataDir)
-
-	// Create a test file within the seeder and baseline provider dir and add it to both clients
-	utils.CreateFilesInDirs(t, []string{seederConfig.DataDir, baselineProviderConfig.DataDir}, utils.TestFileName, 2e9)
-	metaInfo := utils.CreateMetaInfo(t, seederConfig.DataDir, utils.TestFileName, [][]string{{utils.TestTrackerAnnounceUrl}})
-	trackerlessMetaInfo := utils.CreateMetaInfo(t, seederConfig.DataDir, utils.TestFileName, [][]string{})
-	seederTorrent, err := seeder.AddTorrent(&metaInfo)
-	seederTorrent.SmallIntervalAllowed = true
-	utils.TestSeederInitial(t, seederTorrent, err)
-	baselineProvider, _ := rbt.NewClient(baselineProviderConfig)
-	defer baselineProvider.Close()
-	defer os.RemoveAll(baselineProviderConfig.DataDir)
-
-	// Create a leecher
-	leecherConfig := LeecherConfig(0, 0)
-	utils.CreateDir(t, leecherConfig.DataDir)
-	leecher, _ := rbt.NewClient(leecherConfig)
-	defer leecher.Close()
-	defer os.RemoveAll(leecherConfig.DataDir)
-
-	// Also attach the metaInfo to the leecher
-	leecherTorrent, _ := leecher.AddTorrent(&metaInfo)
-	leecherTorrent.SmallIntervalAllowed = true
-	<-leecherTorrent.GotInfo()
-
-	leecherTorrent.DownloadAll()
+	// Keep the 2GB test file in virtual storages rather than on disk, with the seeder and baseline provider complete
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{FileSize: 2e9, Virtual: true, Seeders: 1, Leechers: 1, SmallInterval: true})
+	seeder := swarm.Seeder(0)
 
-	// Sleep for 3 seconds and close seeder
+	swarm.DownloadAll()
+
+	// Sleep for 3 seconds
 	time.Sleep(3 * time.Second)
-	seederUploadedBytes := seederTorrent.UploadedBytes()
+	seederUploadedBytes := seeder.Torrent.UploadedBytes()
 	fmt.Println("Seeder Uploaded Bytes after 3 seconds: ", seederUploadedBytes)
-	fmt.Println("Seeder Downloaded Bytes after 3 seconds: ", seederTorrent.DownloadedBytes())
+	fmt.Println("Seeder Downloaded Bytes after 3 seconds: ", seeder.Torrent.DownloadedBytes())
 
-	// Start baseline provider
-	baselineProviderTorrent, err := baselineProvider.AddTorrent(&trackerlessMetaInfo)
-	baselineProviderTorrent.SmallIntervalAllowed = true
-	utils.TestSeederInitial(t, baselineProviderTorrent, err)
+	// Start baseline provider (on a free port, trusted by the tracker)
+	baselineProvider := swarm.AddTrackerlessPeer(utils.BaselineProvider, 0)
 
 	// Let it process that it has the complete file,
 	// So it will promote itself to the tracker as a complete baseline provider right away
 	time.Sleep(3 * time.Second)
-	baselineProviderTorrent.AddTrackers([][]string{{utils.TestTrackerAnnounceUrl}})
+	swarm.AddTrackers(baselineProvider)
 
 	// Wait until transfer is complete
-	leecher.WaitAll()
-	baselineProviderUploadedBytes := baselineProviderTorrent.UploadedBytes()
+	swarm.WaitLeechers()
+	baselineProviderUploadedBytes := baselineProvider.Torrent.UploadedBytes()
 	fmt.Println("Baseline Provider Uploaded Bytes: ", baselineProviderUploadedBytes)
-	fmt.Println("Baseline Provider Downloaded Bytes: ", baselineProviderTorrent.DownloadedBytes())
+	fmt.Println("Baseline Provider Downloaded Bytes: ", baselineProvider.Torrent.DownloadedBytes())
 
 	// Verify that baseline provider does contribute to the leecher
 	if seederUploadedBytes < 2e9 {
@@ -157,9 +121,9 @@ func TestSeederWaitAndBaselineProviderJoin(t *testing.T) {
 	}
 
 	// Verify baseline provider (baseline provider should not get itself as baseline provider)
-	utils.VerifyBaselineProvider(t, []*rbt.Torrent{leecherTorrent}, []int{baselineProviderPort})
-	utils.VerifyBaselineProvider(t, []*rbt.Torrent{baselineProviderTorrent}, []int{})
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Leecher), []int{baselineProvider.Client.LocalPort()})
+	utils.VerifyBaselineProvider(t, []*rbt.Torrent{baselineProvider.Torrent}, []int{})
 
-	// Verify file content equality
-	utils.VerifyFileContent(t, utils.TestFileName, seederConfig.DataDir, []string{leecherConfig.DataDir})
+	// Verify file content (every piece of the leecher passed its hash check and matches the content)
+	utils.VerifyVirtualContent(t, swarm.Storages(utils.Leecher))
 }
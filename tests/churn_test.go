@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"math/rand"
+	"rbtValidation/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test whether the durations drawn from each distribution have the expected mean and bounds.
+func TestChurnDistributions(t *testing.T) {
+	r := rand.New(rand.NewSource(utils.TestSeed(t)))
+	mean := func(d utils.Distribution) time.Duration {
+		var sum time.Duration
+		for i := 0; i < 10000; i++ {
+			sample := d.Sample(r)
+			require.GreaterOrEqual(t, sample, time.Duration(0))
+			sum += sample
+		}
+		return sum / 10000
+	}
+	require.Equal(t, time.Second, mean(utils.Constant(time.Second)))
+	require.InDelta(t, float64(time.Second), float64(mean(utils.Exponential{Mean: time.Second})), 0.05*float64(time.Second))
+	require.InDelta(t, float64(2*time.Second), float64(mean(utils.Uniform{Min: time.Second, Max: 3 * time.Second})), 0.05*float64(time.Second))
+}
+
+// Test whether distributions that would never advance or cannot be sampled are rejected.
+func TestChurnDistributionsValidate(t *testing.T) {
+	for _, d := range []utils.Distribution{
+		utils.Constant(time.Second),
+		utils.Exponential{Mean: time.Second},
+		utils.Uniform{Min: time.Second, Max: 3 * time.Second},
+		utils.Uniform{Max: time.Second},
+	} {
+		require.NoError(t, d.Validate(), "%#v", d)
+	}
+	for _, d := range []utils.Distribution{
+		utils.Constant(0),
+		utils.Constant(-time.Second),
+		utils.Exponential{},
+		utils.Exponential{Mean: -time.Second},
+		utils.Uniform{},
+		utils.Uniform{Min: 3 * time.Second, Max: time.Second},
+		utils.Uniform{Min: -time.Second, Max: time.Second},
+	} {
+		require.Error(t, d.Validate(), "%#v", d)
+	}
+}
+
+// Starts with a seeder and a baseline provider, while leechers keep arriving (as a Poisson process, with a flash
+// crowd on top) and leaving after exponentially distributed sessions, and extra seeders come and go.
+// Expectation: every leecher that stays long enough completes, and the baseline provider absorbs part of the load.
+func TestChurn(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{FileSize: 1e7, Virtual: true, Seeders: 1, BaselineProviderPorts: []int{0}, SmallInterval: true})
+	stats := utils.RunChurn(swarm, utils.ChurnConfig{
+		Duration:        10 * time.Second,
+		LeecherArrivals: utils.Exponential{Mean: time.Second},
+		LeecherSessions: utils.Exponential{Mean: 10 * time.Second},
+		SeederArrivals:  utils.Exponential{Mean: 4 * time.Second},
+		SeederSessions:  utils.Exponential{Mean: 4 * time.Second},
+		FlashCrowds:     []utils.FlashCrowd{{At: 5 * time.Second, Leechers: 5}},
+		Drain:           time.Minute,
+	})
+	stats.Log(t)
+
+	require.GreaterOrEqual(t, stats.LeechersArrived, 5)
+	require.Equal(t, stats.LeechersArrived, stats.LeechersCompleted+stats.LeechersAbandoned, "leechers still downloading")
+	require.NotZero(t, stats.LeechersCompleted)
+	require.Len(t, stats.CompletionTimes, stats.LeechersCompleted)
+	require.NotZero(t, stats.BytesFromBaselineProviders)
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"io"
+	"path/filepath"
+	"rbtValidation/utils"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test whether seeded content is the same whenever it is generated, and can be read from any offset.
+func TestSeededContent(t *testing.T) {
+	content := utils.Content{Seed: 416, Size: 1e6 + 123}
+	full, err := io.ReadAll(content.Reader())
+	require.NoError(t, err)
+	require.Len(t, full, int(content.Size))
+
+	again, err := io.ReadAll(utils.Content{Seed: 416, Size: content.Size}.Reader())
+	require.NoError(t, err)
+	require.Equal(t, full, again)
+
+	other, err := io.ReadAll(utils.Content{Seed: 417, Size: content.Size}.Reader())
+	require.NoError(t, err)
+	require.NotEqual(t, full, other)
+
+	// Reads starting anywhere, including across blocks and past the end, should match the full content
+	for _, off := range []int64{0, 1, 65535, 65536, 100000, content.Size - 10} {
+		buf := make([]byte, 70000)
+		n, err := content.ReadAt(buf, off)
+		if off+int64(len(buf)) > content.Size {
+			require.Equal(t, io.EOF, err)
+		} else {
+			require.NoError(t, err)
+		}
+		require.Equal(t, full[off:off+int64(n)], buf[:n], "read at offset %d", off)
+	}
+}
+
+// Test whether test files are created from the seed of the test, so they can be checked against the seed alone.
+func TestCreateFilesFromSeed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, utils.TestFileName)
+	utils.CreateFiles(t, []string{path}, 3e6)
+	utils.VerifyContent(t, path, utils.TestContent(t, 3e6))
+}
+
+// Test whether files holding the content of a torrent pass the verification against its piece hashes and SHA-256 sum.
+func TestVerifyPieces(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	utils.CreateFilesInDirs(t, dirs, utils.TestFileName, 1e6+123)
+	metaInfo := utils.CreateMetaInfo(t, dirs[0], utils.TestFileName, [][]string{})
+	utils.VerifyPieces(t, &metaInfo, dirs)
+
+	h := sha256.New()
+	_, err := io.Copy(h, utils.TestContent(t, 1e6+123).Reader())
+	require.NoError(t, err)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	utils.VerifySHA256(t, utils.TestFileName, dirs, sum)
+}
@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"rbtValidation/utils"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Starts with an honest seeder or baseline provider, whose links to the leechers are throttled, and a seeder serving
+// corrupted chunks at the given rate over unthrottled links, then has the leechers download.
+// Expectation: the leechers reject the corrupted pieces through their hash checks, ban the corrupting seeder, and
+// still complete the download with the correct content from the honest peer.
+func corruptingSeeder(t *testing.T, honest utils.Role, rate float64) {
+	config := utils.SwarmConfig{
+		FileSize:      1e7,
+		Leechers:      2,
+		Proxied:       true,
+		SmallInterval: true,
+	}
+	if honest == utils.BaselineProvider {
+		config.BaselineProviderPorts = []int{0}
+	} else {
+		config.Seeders = 1
+	}
+	swarm := utils.NewSwarm(t, config)
+	honestPeer := swarm.Peers(honest)[0]
+	corrupting := swarm.AddCorruptingPeer(utils.Seeder, rate)
+	leechers := swarm.Peers(utils.Leecher)
+	for _, leecher := range leechers {
+		swarm.SetLinkFaults(leecher, honestPeer, utils.LinkFaults{Bandwidth: 2e6})
+	}
+
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+
+	require.NotZero(t, corrupting.Corrupting.Corrupted(), "no corrupted chunk served")
+	utils.VerifyBanned(t, swarm, corrupting, leechers)
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// A seeder corrupting every chunk it serves, next to an honest seeder.
+func TestCorruptingSeederFullyCorrupt(t *testing.T) {
+	corruptingSeeder(t, utils.Seeder, 1)
+}
+
+// A seeder corrupting a quarter of the chunks it serves, next to a baseline provider as the only honest peer.
+func TestCorruptingSeederPartlyCorruptBaselineProvider(t *testing.T) {
+	corruptingSeeder(t, utils.BaselineProvider, 0.25)
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"rbtValidation/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// How long after the death of the seeder the leecher got its first byte from the baseline provider, and completed.
+type handOver struct {
+	firstByte time.Duration
+	complete  time.Duration
+}
+
+// Starts with a throttled seeder and a leecher, whose link to the baseline provider is down, runs for 3s,
+// then kills the seeder (cleanly, or by crashing it) and brings the link to the baseline provider up once the seeder is
+// gone (for a clean close, once the data it sent before drained).
+// Expectation: the leecher should finish the rest of the download with the baseline provider.
+func seederDeathHandOver(t *testing.T, crash bool) (h handOver) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Seeders:               1,
+		BaselineProviderPorts: []int{0},
+		Leechers:              1,
+		Proxied:               true,
+		SmallInterval:         true,
+	})
+	seeder, baselineProvider, leecher := swarm.Seeder(0), swarm.BaselineProvider(0), swarm.Leecher(0)
+	seederID := [20]byte(seeder.Client.PeerID())
+	swarm.SetLinkFaults(leecher, seeder, utils.LinkFaults{Bandwidth: 1e5})
+	swarm.SetLinkFaults(leecher, baselineProvider, utils.LinkFaults{Down: true})
+
+	swarm.DownloadAll()
+	time.Sleep(3 * time.Second)
+	require.NotZero(t, seeder.Torrent.UploadedBytes())
+
+	// A crashed seeder leaves its connections hanging, a closed one tears them down once the data it sent drained
+	numConns := func() int { return swarm.Link(leecher, seeder).NumConns() + swarm.Link(seeder, leecher).NumConns() }
+	if crash {
+		swarm.Crash(seeder)
+	} else {
+		seeder.Close()
+		require.Eventually(t, func() bool { return numConns() == 0 }, 5*time.Second, 10*time.Millisecond, "connections to the closed seeder still open")
+	}
+	death := time.Now()
+	swarm.SetLinkFaults(leecher, baselineProvider, utils.LinkFaults{})
+
+	swarm.WaitLeechers()
+	h.complete = time.Since(death)
+	for _, r := range swarm.Ledger.Receipts(leecher.String()) {
+		if r.From == baselineProvider.String() && !r.Time.Before(death) {
+			h.firstByte = r.Time.Sub(death)
+			break
+		}
+	}
+
+	// A closed seeder tells the tracker it stopped and leaves the swarm, a crashed one stays until it times out
+	infoHash := swarm.MetaInfo.HashInfoBytes()
+	stopped := func() bool {
+		for _, a := range swarm.Tracker.Recorder.ByPeerID(infoHash)[seederID] {
+			if a.Event == "stopped" {
+				return true
+			}
+		}
+		return false
+	}
+	inSwarm := func() bool {
+		for _, p := range swarm.Tracker.Peers(infoHash) {
+			if p.ID == seederID {
+				return true
+			}
+		}
+		return false
+	}
+	if crash {
+		require.False(t, stopped(), "crashed seeder told the tracker it stopped")
+		require.True(t, inSwarm(), "crashed seeder left the swarm")
+		require.NotZero(t, numConns(), "connections to the crashed seeder were closed")
+	} else {
+		require.Eventually(t, stopped, 5*time.Second, 100*time.Millisecond, "closed seeder did not tell the tracker it stopped")
+		require.False(t, inSwarm(), "closed seeder still in the swarm")
+	}
+
+	utils.VerifyAttribution(t, swarm.Ledger, leecher.String(), leecher.Torrent.BytesCompleted())
+	utils.VerifyContribution(t, swarm.Ledger, leecher.String(), []string{baselineProvider.String()}, death, 0.99)
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+	return
+}
+
+// Compare how quickly the leecher falls back to the baseline provider when the seeder closes cleanly,
+// and when it crashes without anyone hearing about it.
+func TestSeederGracefulVsCrashHandOver(t *testing.T) {
+	results := make(map[string]handOver)
+	for _, mode := range []struct {
+		name  string
+		crash bool
+	}{{"graceful", false}, {"crash", true}} {
+		t.Run(mode.name, func(t *testing.T) {
+			results[mode.name] = seederDeathHandOver(t, mode.crash)
+		})
+	}
+	for name, h := range results {
+		t.Logf("%s: first byte from the baseline provider %v after the seeder died, complete after %v",
+			name, h.firstByte.Round(time.Millisecond), h.complete.Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"rbtValidation/tracker"
+	"rbtValidation/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// Upload rate of each baseline provider in the failover tests, so the download outlasts the first baseline provider
+	failoverUploadRate = 256 << 10
+	// Time after which the tracker drops a peer that stopped announcing
+	failoverPeerTimeout = 3 * tracker.DefaultInterval
+	// Time the tracker and the leechers may take to fail over once a baseline provider died: the tracker drops it after
+	// the peer timeout, and everyone hears of its successor at their next announce
+	failoverBound = failoverPeerTimeout + 3*tracker.DefaultInterval
+)
+
+// Create a swarm of leechers served by throttled baseline providers alone, with a tracker dropping peers that stopped
+// announcing, and start the download.
+func failoverSwarm(t *testing.T, baselineProviders int, leechers int, proxied bool) *utils.Swarm {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		BaselineProviderPorts: make([]int, baselineProviders),
+		Leechers:              leechers,
+		Proxied:               proxied,
+		TrackerPeerTimeout:    failoverPeerTimeout,
+		Configure: func(p *utils.Peer) {
+			if p.Role == utils.BaselineProvider {
+				p.Config.UploadRateLimiter = rate.NewLimiter(failoverUploadRate, utils.DefaultChunkSize)
+			}
+		},
+		SmallInterval: true,
+	})
+	swarm.DownloadAll()
+	return swarm
+}
+
+// Wait until the tracker promoted a baseline provider and every leecher took it for theirs and got some data, and
+// return it. Fails if a leecher already completed, as failing over would then prove nothing.
+func waitTransferring(t *testing.T, swarm *utils.Swarm) (bp *utils.Peer) {
+	swarm.WaitPromoted()
+	bp = swarm.PromotedBaselineProvider()
+	require.NotNil(t, bp)
+	for _, leecher := range swarm.Peers(utils.Leecher) {
+		require.Eventually(t, func() bool {
+			return swarm.TakesForBaselineProvider(leecher, bp) && leecher.Torrent.BytesCompleted() != 0
+		}, 5*tracker.DefaultInterval, 100*time.Millisecond, "%s did not start downloading with %s", leecher, bp)
+		require.NotZero(t, leecher.Torrent.BytesMissing(), "%s completed before the failover", leecher)
+	}
+	return
+}
+
+// Starts with two trusted baseline providers and two leechers, then kills the promoted baseline provider mid-transfer.
+// Expectation: the tracker promotes the other baseline provider, the leechers switch to it within the bound, and the
+// download completes.
+func TestBaselineProviderFailover(t *testing.T) {
+	swarm := failoverSwarm(t, 2, 2, false)
+	leechers := swarm.Peers(utils.Leecher)
+	active := waitTransferring(t, swarm)
+
+	active.Close()
+	next := swarm.WaitFailover(active, leechers, failoverBound)
+
+	swarm.WaitLeechers()
+	utils.VerifySwarmBaselineProvider(t, swarm, leechers, []*utils.Peer{next})
+	require.NotZero(t, next.Torrent.UploadedBytes())
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with three trusted baseline providers and two leechers in a proxied swarm, crashes the promoted baseline
+// provider mid-transfer, and once everyone failed over kills its successor as well.
+// Expectation: each time the tracker promotes one of the remaining baseline providers and the leechers switch to it
+// within the bound, until the last one is left, which completes the download.
+func TestBaselineProviderFailoverChain(t *testing.T) {
+	swarm := failoverSwarm(t, 3, 2, true)
+	leechers := swarm.Peers(utils.Leecher)
+	first := waitTransferring(t, swarm)
+
+	swarm.Crash(first)
+	second := swarm.WaitFailover(first, leechers, failoverBound)
+	for _, leecher := range leechers {
+		require.NotZero(t, leecher.Torrent.BytesMissing(), "%s completed before the second failover", leecher)
+	}
+	second.Close()
+	last := swarm.WaitFailover(second, leechers, failoverBound)
+	require.NotEqual(t, first, last)
+
+	swarm.WaitLeechers()
+	utils.VerifySwarmBaselineProvider(t, swarm, leechers, []*utils.Peer{last})
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
@@ -0,0 +1,61 @@
+//go:build unix
+
+package tests
+
+import (
+	"os"
+	"rbtValidation/utils"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// Environment variable setting the number of leechers of the flash crowd, e.g. 200.
+	flashCrowdEnv = "RBT_FLASH_CROWD"
+	// Number of leechers of the flash crowd by default.
+	defaultFlashCrowd = 50
+	// How long the whole flash crowd may take to complete.
+	flashCrowdTimeout = 10 * time.Minute
+)
+
+// Starts with a seeder and a baseline provider, then has a flash crowd of leechers (RBT_FLASH_CROWD, 50 by default)
+// start downloading all at once, each held to a share of the file descriptors of the process.
+// Expectation: every leecher completes, and the completion time percentiles are reported.
+func TestFlashCrowd(t *testing.T) {
+	n := defaultFlashCrowd
+	if env := os.Getenv(flashCrowdEnv); env != "" {
+		var err error
+		n, err = strconv.Atoi(env)
+		require.NoError(t, err, "invalid %s", flashCrowdEnv)
+	}
+	budget := utils.BudgetSwarm(t, n+2)
+
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Virtual:               true,
+		Seeders:               1,
+		BaselineProviderPorts: []int{0},
+		Leechers:              n,
+		Configure: func(p *utils.Peer) {
+			budget.Configure(p)
+			// Keep seeding once complete, as in a real flash crowd, so the connection slots of a completed leecher
+			// stay useful to the others
+			p.Config.Seed = true
+		},
+		SmallInterval: true,
+	})
+	start := time.Now()
+	swarm.DownloadAll()
+	times := swarm.WaitCompletionTimes(start, flashCrowdTimeout)
+	utils.LogMemory(t)
+
+	require.Len(t, times, n)
+	t.Logf("Flash crowd of %d leechers: p50 %v, p90 %v, p99 %v, max %v", n,
+		utils.Percentile(times, 50).Round(time.Millisecond), utils.Percentile(times, 90).Round(time.Millisecond),
+		utils.Percentile(times, 99).Round(time.Millisecond), utils.Percentile(times, 100).Round(time.Millisecond))
+	utils.VerifyVirtualContent(t, swarm.Storages(utils.Leecher))
+	require.NotZero(t, swarm.BaselineProvider(0).Torrent.UploadedBytes())
+}
@@ -0,0 +1,250 @@
+package tests
+
+import (
+	"net"
+	"rbtValidation/tracker"
+	"rbtValidation/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Check that the tracker still promotes the given baseline provider, under its own peer id.
+func requirePromoted(t *testing.T, swarm *utils.Swarm, bp *utils.Peer) {
+	promoted, ok := swarm.Tracker.BaselineProvider(swarm.MetaInfo.HashInfoBytes())
+	require.True(t, ok, "no baseline provider promoted")
+	require.Equal(t, bp.Client.LocalPort(), promoted.Port)
+	require.Equal(t, [20]byte(bp.Client.PeerID()), promoted.ID)
+}
+
+// Starts with a seeder, a baseline provider and two leechers, plus an impostor on an untrusted port claiming to be a
+// baseline provider in its handshakes and announces, which the leechers are also told about directly.
+// Expectation: the leechers download from the impostor as from any peer, but keep the baseline provider named by the
+// tracker as theirs.
+func TestImpostorHandshakeClaim(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Seeders:               1,
+		BaselineProviderPorts: []int{0},
+		Leechers:              2,
+		SmallInterval:         true,
+	})
+	bp := swarm.BaselineProvider(0)
+	impostor := swarm.AddImpostor(0)
+	for _, leecher := range swarm.Peers(utils.Leecher) {
+		swarm.Connect(leecher, impostor)
+	}
+
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+	// Let everyone announce again with the final state
+	time.Sleep(2 * tracker.DefaultInterval)
+
+	requirePromoted(t, swarm, bp)
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Leecher), []int{bp.Client.LocalPort()})
+	utils.VerifyNotFavored(t, swarm, impostor, swarm.Peers(utils.Leecher))
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with a seeder, a baseline provider, a leecher and an impostor on another port of the same IP as the baseline
+// provider, then announces from the address of the baseline provider itself under another peer id: first as a
+// complete reliable peer, then as stopped.
+// Expectation: the tracker rejects both announces and keeps the baseline provider promoted, and the leecher keeps it
+// as its baseline provider.
+func TestImpostorOnBaselineProviderAddress(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Seeders:               1,
+		BaselineProviderPorts: []int{0},
+		Leechers:              1,
+		WaitPromoted:          true,
+		SmallInterval:         true,
+	})
+	bp := swarm.BaselineProvider(0)
+	impostor := swarm.AddImpostor(0)
+
+	spoofed := tracker.AnnounceRequest{InfoHash: swarm.MetaInfo.HashInfoBytes(), Port: bp.Client.LocalPort(), Reliable: true}
+	copy(spoofed.PeerID[:], utils.ImpostorPeerIDPrefix)
+	_, err := tracker.Announce(swarm.Tracker.AnnounceURL(), spoofed)
+	require.ErrorContains(t, err, "held by another peer")
+	spoofed.Event = "stopped"
+	_, err = tracker.Announce(swarm.Tracker.AnnounceURL(), spoofed)
+	require.ErrorContains(t, err, "held by another peer")
+	requirePromoted(t, swarm, bp)
+
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+	time.Sleep(2 * tracker.DefaultInterval)
+
+	requirePromoted(t, swarm, bp)
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Leecher), []int{bp.Client.LocalPort()})
+	utils.VerifyNotFavored(t, swarm, impostor, swarm.Peers(utils.Leecher))
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with a seeder, a baseline provider and a leecher, with a tracker dropping peers after 3s without an announce,
+// then closes the baseline provider and restarts it on the same port under a new peer id.
+// Expectation: the tracker rejects another peer id on the port until it dropped the closed baseline provider (whose
+// stopped announce cannot prove it comes from it), then lets the restarted one take the port over and promotes it; the
+// leecher takes it for its baseline provider.
+func TestBaselineProviderRestartsOnSamePort(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Seeders:               1,
+		BaselineProviderPorts: []int{0},
+		Leechers:              1,
+		TrackerPeerTimeout:    3 * time.Second,
+		WaitPromoted:          true,
+		SmallInterval:         true,
+	})
+	infoHash := swarm.MetaInfo.HashInfoBytes()
+	bp := swarm.BaselineProvider(0)
+	port := bp.Client.LocalPort()
+	bp.Close()
+
+	other := tracker.AnnounceRequest{InfoHash: infoHash, Port: port, Left: 1}
+	copy(other.PeerID[:], "-RESTART-")
+	_, err := tracker.Announce(swarm.Tracker.AnnounceURL(), other)
+	require.ErrorContains(t, err, "held by another peer")
+	requirePromoted(t, swarm, bp)
+
+	require.Eventually(t, func() bool {
+		for _, p := range swarm.Tracker.Peers(infoHash) {
+			if p.Port == port {
+				return false
+			}
+		}
+		return true
+	}, 2*3*time.Second, 100*time.Millisecond, "tracker did not drop the closed %s", bp)
+	restarted := swarm.AddPeer(utils.BaselineProvider, port)
+	require.NotEqual(t, bp.Client.PeerID(), restarted.Client.PeerID())
+	require.Eventually(t, func() bool {
+		promoted, ok := swarm.Tracker.BaselineProvider(infoHash)
+		return ok && promoted.ID == [20]byte(restarted.Client.PeerID())
+	}, 5*tracker.DefaultInterval, 100*time.Millisecond, "%s did not take port %d over", restarted, port)
+	requirePromoted(t, swarm, restarted)
+
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+	utils.VerifySwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), []*utils.Peer{restarted})
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with a seeder, a baseline provider and a leecher, then announces from the address of the baseline provider
+// under its own peer id, with higher transfer counters than it reported: as stopped, with something left to download,
+// and without reliable.
+// Expectation: the tracker rejects all three announces and keeps the baseline provider promoted, and the leecher keeps
+// it as its baseline provider.
+func TestImpostorWithBaselineProviderPeerID(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Seeders:               1,
+		BaselineProviderPorts: []int{0},
+		Leechers:              1,
+		WaitPromoted:          true,
+		SmallInterval:         true,
+	})
+	bp := swarm.BaselineProvider(0)
+	forged := tracker.AnnounceRequest{
+		InfoHash: swarm.MetaInfo.HashInfoBytes(),
+		PeerID:   [20]byte(bp.Client.PeerID()),
+		Port:     bp.Client.LocalPort(),
+		Uploaded: 1 << 40,
+		Reliable: true,
+	}
+	for _, forge := range []func(r *tracker.AnnounceRequest){
+		func(r *tracker.AnnounceRequest) { r.Event = "stopped" },
+		func(r *tracker.AnnounceRequest) { r.Left = 1 },
+		func(r *tracker.AnnounceRequest) { r.Reliable = false },
+	} {
+		r := forged
+		forge(&r)
+		_, err := tracker.Announce(swarm.Tracker.AnnounceURL(), r)
+		require.ErrorContains(t, err, "cannot stop or demote")
+		requirePromoted(t, swarm, bp)
+	}
+
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+	time.Sleep(2 * tracker.DefaultInterval)
+
+	requirePromoted(t, swarm, bp)
+	utils.VerifySwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), []*utils.Peer{bp})
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with a baseline provider as the only source of a leecher, and once the leecher completed replays announces
+// the baseline provider sent: its first one, from before it uploaded anything, and its latest one.
+// Expectation: the tracker rejects the stale announce, and the latest one replayed as is changes nothing: the baseline
+// provider stays promoted with the progress it reported.
+func TestReplayedBaselineProviderAnnounce(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		BaselineProviderPorts: []int{0},
+		Leechers:              1,
+		WaitPromoted:          true,
+		SmallInterval:         true,
+	})
+	bp := swarm.BaselineProvider(0)
+	infoHash := swarm.MetaInfo.HashInfoBytes()
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+
+	// Wait until the baseline provider reported its upload
+	reported := func() (p tracker.Peer) {
+		for _, p = range swarm.Tracker.Peers(infoHash) {
+			if p.Port == bp.Client.LocalPort() {
+				return
+			}
+		}
+		return tracker.Peer{}
+	}
+	require.Eventually(t, func() bool { return reported().Uploaded != 0 }, 5*tracker.DefaultInterval, 100*time.Millisecond)
+	before := reported()
+
+	announcements := swarm.Tracker.Recorder.ByPort(infoHash)[bp.Client.LocalPort()]
+	first, latest := announcements[0], announcements[len(announcements)-1]
+	require.Zero(t, first.Uploaded)
+	_, err := tracker.Announce(swarm.Tracker.AnnounceURL(), first.Request())
+	require.ErrorContains(t, err, "stale announce")
+	_, err = tracker.Announce(swarm.Tracker.AnnounceURL(), latest.Request())
+	require.NoError(t, err)
+
+	requirePromoted(t, swarm, bp)
+	require.GreaterOrEqual(t, reported().Uploaded, before.Uploaded)
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Leecher), []int{bp.Client.LocalPort()})
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with a seeder, a baseline provider and two leechers, with the tracker naming a port nobody listens on as
+// baseline provider in its responses, as a compromised tracker would.
+// Expectation: the leechers take the tracker's word for it (the client has no other source), yet still complete the
+// download from the peers actually there, while the tracker keeps the real baseline provider promoted.
+func TestForgedBaselineProvider(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Seeders:               1,
+		BaselineProviderPorts: []int{0},
+		Leechers:              2,
+		WaitPromoted:          true,
+		SmallInterval:         true,
+	})
+	nowhere := utils.FreePort(t)
+	swarm.Tracker.ForgeBaselineProvider(net.ParseIP(utils.Localhost), nowhere)
+
+	swarm.DownloadAll()
+	require.Eventually(t, func() bool {
+		for _, tr := range swarm.Torrents(utils.Leecher) {
+			if _, port := tr.GetBaselineProvider(); port != nowhere {
+				return false
+			}
+		}
+		return true
+	}, 5*tracker.DefaultInterval, 100*time.Millisecond, "leechers did not take up the forged baseline provider")
+	swarm.WaitLeechers()
+
+	requirePromoted(t, swarm, swarm.BaselineProvider(0))
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Leecher), []int{nowhere})
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"rbtValidation/utils"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// A seeder and a leecher, across piece lengths from a single chunk to 16 MiB, file sizes from below a chunk to
+// not a multiple of any piece length, and one to three leechers.
+func TestMatrixSeederLeechers(t *testing.T) {
+	scenario := utils.Scenario{
+		Name: "matrix_seeder_leechers",
+		Peers: []utils.ScenarioPeer{
+			{Name: "seeder", Role: "seeder"},
+			{Name: "leecher", Role: "leecher"},
+		},
+		Timeline: []utils.ScenarioEvent{{Action: utils.ActionDownload}},
+		Expect:   utils.ScenarioExpectation{Complete: []string{"leecher"}, Uploaded: []string{"seeder"}},
+	}
+	m := utils.Matrix{
+		PieceLengths: []int64{16 << 10, 256 << 10, 16 << 20},
+		FileSizes:    []int64{1000, 1e6 + 1, 1e7},
+		Leechers:     []int{1, 3},
+	}
+	results := utils.RunMatrix(t, scenario, m)
+	require.Len(t, results, 18)
+	for _, r := range results {
+		require.True(t, r.Passed, "scenario %s", r.Scenario)
+	}
+}
+
+// Copies of a leecher are named after it, and stand in for it wherever it is named.
+func TestMatrixWithLeechers(t *testing.T) {
+	scenario := utils.Scenario{
+		Peers: []utils.ScenarioPeer{
+			{Name: "seeder", Role: "seeder"},
+			{Name: "leecher", Role: "leecher", Port: 5000},
+		},
+		Timeline: []utils.ScenarioEvent{{Action: utils.ActionDownload, Peers: []string{"leecher"}}},
+		Expect:   utils.ScenarioExpectation{Complete: []string{"leecher", "seeder"}},
+	}
+	sc := scenario.WithLeechers(3)
+	require.Len(t, sc.Peers, 4)
+	require.Equal(t, "leecher_3", sc.Peers[3].Name)
+	require.Zero(t, sc.Peers[3].Port)
+	require.Equal(t, []string{"leecher", "leecher_2", "leecher_3"}, sc.Timeline[0].Peers)
+	require.Equal(t, []string{"leecher", "leecher_2", "leecher_3", "seeder"}, sc.Expect.Complete)
+	// The original scenario is left as is
+	require.Equal(t, []string{"leecher"}, scenario.Timeline[0].Peers)
+	require.Len(t, scenario.Peers, 2)
+}
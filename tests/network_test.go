@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"rbtValidation/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// With every link slowed down by latency, jitter, packet loss and a bandwidth cap
+// Expectation: leechers should still finish downloading, and know about the baseline provider
+func TestSlowLinks(t *testing.T) {
+	baselineProviderPort := utils.FreePort(t)
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e6,
+		Seeders:               1,
+		BaselineProviderPorts: []int{baselineProviderPort},
+		Leechers:              2,
+		Proxied:               true,
+		WaitPromoted:          true,
+		SmallInterval:         true,
+	})
+	swarm.Network.SetAll(utils.LinkFaults{
+		Latency:    20 * time.Millisecond,
+		Jitter:     10 * time.Millisecond,
+		PacketLoss: 0.01,
+		Bandwidth:  1e6,
+	})
+
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+
+	utils.VerifySwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), swarm.Peers(utils.BaselineProvider))
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// With half of the new connections between peers dropped right away
+// Expectation: leechers should keep retrying and still finish downloading
+func TestConnectionDrops(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{FileSize: 1e6, Seeders: 1, BaselineProviderPorts: []int{utils.FreePort(t)}, Leechers: 2, Proxied: true, SmallInterval: true})
+	swarm.Network.SetAll(utils.LinkFaults{ConnDropRate: 0.5})
+
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with a leecher downloading from a seeder over a narrow link, while its link to the baseline provider is down,
+// then resets the connection to the seeder mid-transfer and takes that link down, while the baseline provider comes up.
+// Expectation: the leecher should finish the rest of the download with the baseline provider.
+func TestSeederLinkResetHandOverToBaselineProvider(t *testing.T) {
+	baselineProviderPort := utils.FreePort(t)
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Seeders:               1,
+		BaselineProviderPorts: []int{baselineProviderPort},
+		Leechers:              1,
+		Proxied:               true,
+		SmallInterval:         true,
+	})
+	seeder, baselineProvider, leecher := swarm.Seeder(0), swarm.BaselineProvider(0), swarm.Leecher(0)
+	swarm.SetLinkFaults(leecher, seeder, utils.LinkFaults{Bandwidth: 1e5})
+	swarm.SetLinkFaults(leecher, baselineProvider, utils.LinkFaults{Down: true})
+
+	swarm.DownloadAll()
+	time.Sleep(3 * time.Second)
+	require.NotZero(t, seeder.Torrent.UploadedBytes())
+	require.NotZero(t, swarm.Link(leecher, seeder).NumConns()+swarm.Link(seeder, leecher).NumConns())
+	// Nothing gets through the link to the baseline provider while it is down
+	require.Zero(t, baselineProvider.Torrent.UploadedBytes())
+	require.Zero(t, swarm.Ledger.BytesBySender(leecher.String())[baselineProvider.String()])
+
+	// Swap the links around, aborting the transfer from the seeder: once its connections are gone, nothing from it can
+	// still be on its way
+	swarm.SetLinkFaults(leecher, seeder, utils.LinkFaults{Down: true})
+	swarm.ResetLinks(leecher, seeder)
+	require.Eventually(t, func() bool {
+		return swarm.Link(leecher, seeder).NumConns()+swarm.Link(seeder, leecher).NumConns() == 0
+	}, 5*time.Second, 10*time.Millisecond, "connections to %s still open after the reset", seeder)
+	reset := time.Now()
+	swarm.SetLinkFaults(leecher, baselineProvider, utils.LinkFaults{})
+
+	swarm.WaitLeechers()
+	require.NotZero(t, baselineProvider.Torrent.UploadedBytes())
+
+	// Verify the seeder supplied nothing once cut off, and the baseline provider (nearly) everything
+	utils.VerifyAttribution(t, swarm.Ledger, leecher.String(), leecher.Torrent.BytesCompleted())
+	fromSeeder, _ := swarm.Ledger.BytesFrom(leecher.String(), []string{seeder.String()}, reset)
+	require.Zero(t, fromSeeder, "%s got data from %s after the reset", leecher, seeder)
+	utils.VerifyContribution(t, swarm.Ledger, leecher.String(), []string{baselineProvider.String()}, reset, 0.99)
+	utils.VerifySwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), swarm.Peers(utils.BaselineProvider))
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
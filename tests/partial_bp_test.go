@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"rbtValidation/tracker"
+	"rbtValidation/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// Upload rate of the seeder in the partial baseline provider tests, so the baseline provider takes a while to complete
+	partialSeederRate = 512 << 10
+	// Download rate of the leechers until the baseline provider completed, so it completes first
+	partialLeecherRate = 32 << 10
+)
+
+// Starts with a throttled seeder and two throttled leechers in a proxied swarm, then adds a trusted baseline provider
+// holding the given share of the pieces, which downloads the rest. Once it completed, a late leecher joins.
+// Expectation: the baseline provider announces as reliable all along, but neither the tracker nor the leechers take
+// it for a baseline provider until it completed; then the tracker promotes it and the leechers switch to it within a
+// few announce intervals. Once complete it does not dial out, so the late leecher has to connect to it. Everyone ends
+// up with the file. Whether it dials out while incomplete is left to TestIncompleteBaselineProviderDialsOut.
+func partialBaselineProvider(t *testing.T, share float64) {
+	var leecherLimiters []*rate.Limiter
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize: 1e7,
+		Seeders:  1,
+		Leechers: 2,
+		Proxied:  true,
+		Configure: func(p *utils.Peer) {
+			switch p.Role {
+			case utils.Seeder:
+				p.Config.UploadRateLimiter = rate.NewLimiter(partialSeederRate, utils.DefaultChunkSize)
+			case utils.Leecher:
+				limiter := rate.NewLimiter(partialLeecherRate, utils.DefaultChunkSize)
+				leecherLimiters = append(leecherLimiters, limiter)
+				p.Config.DownloadRateLimiter = limiter
+			}
+		},
+		SmallInterval: true,
+	})
+	leechers := swarm.Peers(utils.Leecher)
+	bp := swarm.AddPartialBaselineProvider(0, share)
+	require.NotZero(t, bp.Torrent.BytesMissing())
+	if share == 0 {
+		require.Zero(t, bp.Torrent.BytesCompleted())
+	} else {
+		require.NotZero(t, bp.Torrent.BytesCompleted())
+	}
+
+	swarm.DownloadAll()
+	bp.Torrent.DownloadAll()
+	completed := swarm.WaitPartialComplete(bp, leechers)
+	utils.VerifyPromotedOnCompletion(t, swarm, bp, completed, leechers)
+
+	inbound := swarm.DialsTo(bp)
+	require.NotEmpty(t, inbound, "no peer connected to %s", bp)
+	require.True(t, inbound[0].Before(completed), "no peer connected to %s while incomplete", bp)
+	late := swarm.AddPeer(utils.Leecher, 0)
+	late.Torrent.DownloadAll()
+	require.Eventually(t, func() bool {
+		return len(swarm.Link(late, bp).Dials()) != 0
+	}, 5*tracker.DefaultInterval, 100*time.Millisecond, "%s did not connect to %s", late, bp)
+	// Leave the baseline provider a few announces to hear of the late leecher
+	time.Sleep(3 * tracker.DefaultInterval)
+	require.Empty(t, swarm.Link(bp, late).Dials(), "%s dialed %s once complete", bp, late)
+
+	for _, limiter := range leecherLimiters {
+		limiter.SetLimit(rate.Inf)
+	}
+	swarm.WaitLeechers()
+	utils.VerifyPieces(t, &swarm.MetaInfo, append(swarm.DataDirs(utils.Leecher), bp.Config.DataDir))
+}
+
+// Test a baseline provider starting without any piece of the file, see partialBaselineProvider.
+func TestEmptyBaselineProvider(t *testing.T) {
+	partialBaselineProvider(t, 0)
+}
+
+// Test a baseline provider starting with half of the pieces of the file, see partialBaselineProvider.
+func TestHalfCompleteBaselineProvider(t *testing.T) {
+	partialBaselineProvider(t, 0.5)
+}
+
+// Starts with a throttled seeder in a proxied swarm, then adds a trusted baseline provider without any piece of the
+// file, which downloads it.
+// Expectation: while incomplete, the baseline provider dials out like any leecher, here to the seeder, before it
+// completes.
+func TestIncompleteBaselineProviderDialsOut(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize: 1e7,
+		Seeders:  1,
+		Proxied:  true,
+		Configure: func(p *utils.Peer) {
+			if p.Role == utils.Seeder {
+				p.Config.UploadRateLimiter = rate.NewLimiter(partialSeederRate, utils.DefaultChunkSize)
+			}
+		},
+		SmallInterval: true,
+	})
+	seeder := swarm.Seeder(0)
+	bp := swarm.AddPartialBaselineProvider(0, 0)
+	bp.Torrent.DownloadAll()
+
+	require.Eventually(t, func() bool {
+		return len(swarm.Link(bp, seeder).Dials()) != 0
+	}, 5*tracker.DefaultInterval, 100*time.Millisecond, "%s did not dial %s while incomplete", bp, seeder)
+	completed := swarm.WaitPartialComplete(bp, nil)
+	require.True(t, swarm.Link(bp, seeder).Dials()[0].Before(completed), "%s only dialed %s once complete", bp, seeder)
+	utils.VerifyPieces(t, &swarm.MetaInfo, []string{bp.Config.DataDir})
+}
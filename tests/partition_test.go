@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"rbtValidation/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Starts with a throttled seeder, a baseline provider and leechers, runs for 2s,
+// then cuts the seeder off from everyone else, and heals the partition once the leechers are done.
+// Expectation: the leechers should finish the rest of the download with the baseline provider,
+// and keep knowing about it throughout.
+func TestPartitionSeederFromLeechers(t *testing.T) {
+	baselineProviderPort := utils.FreePort(t)
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Seeders:               1,
+		BaselineProviderPorts: []int{baselineProviderPort},
+		Leechers:              2,
+		Proxied:               true,
+		WaitPromoted:          true,
+		SmallInterval:         true,
+	})
+	seeder := swarm.Seeder(0)
+	for _, leecher := range swarm.Peers(utils.Leecher) {
+		swarm.SetLinkFaults(leecher, seeder, utils.LinkFaults{Bandwidth: 1e5})
+	}
+	stopWatching := utils.WatchSwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), swarm.Peers(utils.BaselineProvider))
+
+	swarm.DownloadAll()
+	time.Sleep(2 * time.Second)
+	swarm.Partition([]*utils.Peer{seeder}, swarm.Peers(utils.BaselineProvider, utils.Leecher))
+
+	swarm.WaitLeechers()
+	swarm.Heal()
+
+	stopWatching()
+	require.NotZero(t, swarm.BaselineProvider(0).Torrent.UploadedBytes())
+	utils.VerifySwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), swarm.Peers(utils.BaselineProvider))
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with leechers cut off from both the seeder and the baseline provider for 3s, then heals the partition.
+// Expectation: no connection across the partition is open and nothing crosses it while it holds, and the leechers
+// finish once it heals.
+func TestPartitionLeechersThenHeal(t *testing.T) {
+	baselineProviderPort := utils.FreePort(t)
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e6,
+		Seeders:               1,
+		BaselineProviderPorts: []int{baselineProviderPort},
+		Leechers:              2,
+		Proxied:               true,
+		SmallInterval:         true,
+	})
+	swarm.Partition(swarm.Peers(utils.Seeder, utils.BaselineProvider), swarm.Peers(utils.Leecher))
+	stopWatching := utils.WatchSwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), swarm.Peers(utils.BaselineProvider))
+
+	swarm.DownloadAll()
+	time.Sleep(3 * time.Second)
+	for _, leecher := range swarm.Peers(utils.Leecher) {
+		for _, peer := range swarm.Peers(utils.Seeder, utils.BaselineProvider) {
+			require.Zero(t, swarm.Link(leecher, peer).NumConns()+swarm.Link(peer, leecher).NumConns(), "%s connected to %s across the partition", leecher, peer)
+			require.Zero(t, swarm.Ledger.BytesBySender(leecher.String())[peer.String()], "%s got data from %s across the partition", leecher, peer)
+		}
+	}
+
+	swarm.Heal()
+	swarm.WaitLeechers()
+
+	stopWatching()
+	utils.VerifySwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), swarm.Peers(utils.BaselineProvider))
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with a throttled seeder, a baseline provider and leechers, cuts the leechers off from the tracker after 2s,
+// and heals once they are done.
+// Expectation: the leechers finish the download over the connections they already have,
+// and keep knowing about the baseline provider while the tracker is unreachable.
+func TestTrackerUnreachable(t *testing.T) {
+	baselineProviderPort := utils.FreePort(t)
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:              1e7,
+		Seeders:               1,
+		BaselineProviderPorts: []int{baselineProviderPort},
+		Leechers:              2,
+		Proxied:               true,
+		WaitPromoted:          true,
+		SmallInterval:         true,
+	})
+	seeder := swarm.Seeder(0)
+	for _, leecher := range swarm.Peers(utils.Leecher) {
+		swarm.SetLinkFaults(leecher, seeder, utils.LinkFaults{Bandwidth: 1e5})
+	}
+	stopWatching := utils.WatchSwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), swarm.Peers(utils.BaselineProvider))
+
+	swarm.DownloadAll()
+	time.Sleep(2 * time.Second)
+	swarm.CutTracker(swarm.Peers(utils.Leecher)...)
+
+	swarm.WaitLeechers()
+	swarm.Heal()
+
+	stopWatching()
+	utils.VerifySwarmBaselineProvider(t, swarm, swarm.Peers(utils.Leecher), swarm.Peers(utils.BaselineProvider))
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
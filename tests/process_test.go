@@ -0,0 +1,90 @@
+//go:build unix
+
+package tests
+
+import (
+	"path/filepath"
+	"rbtValidation/tracker"
+	"rbtValidation/utils"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+// Start a tracker and write the torrent of a test file of the given size, created within the dir of every given
+// complete peer (seeder or baseline provider). Returns its metainfo as well, to check the downloaded content against.
+func processSwarm(t *testing.T, fileSize int64, completeDirs []string) (testTracker *tracker.Tracker, torrentFile string, metaInfo metainfo.MetaInfo) {
+	testTracker = utils.StartTracker(t)
+	utils.CreateFilesInDirs(t, completeDirs, utils.TestFileName, fileSize)
+	metaInfo = utils.CreateMetaInfo(t, completeDirs[0], utils.TestFileName, [][]string{{testTracker.AnnounceURL()}})
+	torrentFile = filepath.Join(utils.TestDataDir(t), "test.torrent")
+	utils.WriteTorrentFile(t, &metaInfo, torrentFile)
+	return
+}
+
+// Test whether a seeder and a leecher, each in a process of its own, transfer the file through the tracker,
+// and a frozen seeder stops serving until it is resumed.
+func TestProcessSeederLeecher(t *testing.T) {
+	seederDir, leecherDir := utils.PeerDataDir(t, "seeder", 0), utils.PeerDataDir(t, "leecher", 0)
+	_, torrentFile, metaInfo := processSwarm(t, 1e7, []string{seederDir})
+
+	seeder := utils.StartPeerProcess(t, utils.ProcessConfig{Role: utils.Seeder, DataDir: seederDir, TorrentFile: torrentFile, UploadRate: 2e6})
+	leecher := utils.StartPeerProcess(t, utils.ProcessConfig{Role: utils.Leecher, DataDir: leecherDir, TorrentFile: torrentFile})
+	stats, err := seeder.Stats()
+	require.NoError(t, err)
+	require.True(t, stats.Complete())
+
+	leecher.Download()
+	time.Sleep(time.Second)
+
+	// Nothing should come in while the seeder is frozen
+	seeder.Freeze()
+	time.Sleep(time.Second)
+	frozen, err := leecher.Stats()
+	require.NoError(t, err)
+	require.False(t, frozen.Complete())
+	time.Sleep(2 * time.Second)
+	stats, err = leecher.Stats()
+	require.NoError(t, err)
+	require.Equal(t, frozen.BytesCompleted, stats.BytesCompleted)
+
+	seeder.Resume()
+	leecher.WaitComplete(time.Minute)
+	seeder.Terminate()
+	leecher.Terminate()
+
+	utils.VerifyPieces(t, &metaInfo, []string{leecherDir})
+}
+
+// Starts with a throttled seeder, a baseline provider and a leecher, each in a process of its own,
+// and kills the seeder process (SIGKILL) mid-transfer.
+// Expectation: the leecher should finish the rest of the download with the baseline provider.
+func TestProcessSeederKilledHandOverToBaselineProvider(t *testing.T) {
+	seederDir, baselineProviderDir := utils.PeerDataDir(t, "seeder", 0), utils.PeerDataDir(t, "baselineProvider", 0)
+	leecherDir := utils.PeerDataDir(t, "leecher", 0)
+	testTracker, torrentFile, metaInfo := processSwarm(t, 1e7, []string{seederDir, baselineProviderDir})
+
+	seeder := utils.StartPeerProcess(t, utils.ProcessConfig{Role: utils.Seeder, DataDir: seederDir, TorrentFile: torrentFile, UploadRate: 1e6})
+	baselineProvider := utils.StartPeerProcess(t, utils.ProcessConfig{
+		Role:        utils.BaselineProvider,
+		DataDir:     baselineProviderDir,
+		TorrentFile: torrentFile,
+		Port:        utils.TrustedPort(t, testTracker),
+		UploadRate:  1e6,
+	})
+	leecher := utils.StartPeerProcess(t, utils.ProcessConfig{Role: utils.Leecher, DataDir: leecherDir, TorrentFile: torrentFile})
+
+	leecher.Download()
+	time.Sleep(2 * time.Second)
+	seeder.Kill()
+
+	stats := leecher.WaitComplete(time.Minute)
+	bpStats, err := baselineProvider.Stats()
+	require.NoError(t, err)
+	require.NotZero(t, bpStats.Uploaded)
+	t.Logf("Leecher downloaded %d bytes, %d of them uploaded by the baseline provider", stats.Downloaded, bpStats.Uploaded)
+
+	utils.VerifyPieces(t, &metaInfo, []string{leecherDir})
+}
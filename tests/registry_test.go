@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"rbtValidation/tracker"
+	"rbtValidation/utils"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+// Create an identity, registered with the tracker under the given name unless empty.
+func newIdentity(t *testing.T, tr *tracker.Tracker, name string) *tracker.Identity {
+	id, err := tracker.NewIdentity()
+	require.NoError(t, err)
+	if name != "" {
+		require.NoError(t, tr.Registry.Register(name, id.Public))
+	}
+	return &id
+}
+
+// Create a hand-made announce of a complete, reliable peer on the given port, signed with the given identity.
+func signedAnnounceRequest(port int, id *tracker.Identity) tracker.AnnounceRequest {
+	req := announceRequest(port, 0, true)
+	req.Identity = id
+	return req
+}
+
+// Test whether a peer signing its announces with a registered key is promoted from any port, while neither an unsigned
+// peer on a port that would be trusted nor a peer signing with an unknown key is.
+func TestRegistryRegistration(t *testing.T) {
+	t.Parallel()
+	testTracker := utils.StartTrackerWithConfig(t, tracker.Config{TrustedPorts: []int{4000}, RequireIdentity: true})
+
+	_, err := tracker.Announce(testTracker.AnnounceURL(), announceRequest(4000, 0, true))
+	require.NoError(t, err)
+	_, err = tracker.Announce(testTracker.AnnounceURL(), signedAnnounceRequest(4001, newIdentity(t, testTracker, "")))
+	require.ErrorContains(t, err, tracker.ErrUnknownKey.Error())
+	_, ok := testTracker.BaselineProvider(testInfoHash)
+	require.False(t, ok, "promoted by port alone")
+
+	id := newIdentity(t, testTracker, "bp")
+	require.Error(t, testTracker.Registry.Register("other", id.Public), "key registered twice")
+	_, err = tracker.Announce(testTracker.AnnounceURL(), signedAnnounceRequest(4500, id))
+	require.NoError(t, err)
+	bp, ok := testTracker.BaselineProvider(testInfoHash)
+	require.True(t, ok)
+	require.Equal(t, 4500, bp.Port)
+
+	resp, err := tracker.Announce(testTracker.AnnounceURL(), announceRequest(3001, 100, false))
+	require.NoError(t, err)
+	_, port, err := tracker.ParseCompactAddr(resp.BaselineProvider)
+	require.NoError(t, err)
+	require.Equal(t, 4500, port)
+}
+
+// Test whether rotating the key of a baseline provider demotes it until it announces with the new key, and its old key
+// is rejected from then on.
+func TestRegistryRotation(t *testing.T) {
+	t.Parallel()
+	testTracker := utils.StartTrackerWithConfig(t, tracker.Config{RequireIdentity: true})
+	old := newIdentity(t, testTracker, "bp")
+	_, err := tracker.Announce(testTracker.AnnounceURL(), signedAnnounceRequest(4000, old))
+	require.NoError(t, err)
+
+	rotated := newIdentity(t, testTracker, "")
+	require.NoError(t, testTracker.Registry.Rotate("bp", rotated.Public))
+	require.Error(t, testTracker.Registry.Rotate("unknown", newIdentity(t, testTracker, "").Public))
+	_, ok := testTracker.BaselineProvider(testInfoHash)
+	require.False(t, ok, "still promoted with the rotated key")
+
+	_, err = tracker.Announce(testTracker.AnnounceURL(), signedAnnounceRequest(4000, old))
+	require.ErrorContains(t, err, tracker.ErrRevokedKey.Error())
+	_, err = tracker.Announce(testTracker.AnnounceURL(), signedAnnounceRequest(4000, rotated))
+	require.NoError(t, err)
+	bp, ok := testTracker.BaselineProvider(testInfoHash)
+	require.True(t, ok)
+	require.Equal(t, []byte(rotated.Public), []byte(bp.Key))
+}
+
+// Test whether revoking a baseline provider demotes it at once, and its announces are rejected from then on.
+func TestRegistryRevocation(t *testing.T) {
+	t.Parallel()
+	testTracker := utils.StartTrackerWithConfig(t, tracker.Config{RequireIdentity: true})
+	id := newIdentity(t, testTracker, "bp")
+	_, err := tracker.Announce(testTracker.AnnounceURL(), signedAnnounceRequest(4000, id))
+	require.NoError(t, err)
+	_, ok := testTracker.BaselineProvider(testInfoHash)
+	require.True(t, ok)
+
+	require.NoError(t, testTracker.Registry.Revoke("bp"))
+	require.Error(t, testTracker.Registry.Revoke("bp"), "revoked twice")
+	_, ok = testTracker.BaselineProvider(testInfoHash)
+	require.False(t, ok, "still promoted once revoked")
+	_, err = tracker.Announce(testTracker.AnnounceURL(), signedAnnounceRequest(4000, id))
+	require.ErrorContains(t, err, tracker.ErrRevokedKey.Error())
+	_, trusted := testTracker.Registry.Trusted(id.Public)
+	require.False(t, trusted)
+}
+
+// Test whether signatures that do not match the key, info hash, peer id, port, event, left or time of the announce are
+// rejected, as is an announce replayed with the signature of an accepted one.
+func TestRegistryRejectedSignatures(t *testing.T) {
+	t.Parallel()
+	registry := tracker.NewRegistry()
+	id, err := tracker.NewIdentity()
+	require.NoError(t, err)
+	other, err := tracker.NewIdentity()
+	require.NoError(t, err)
+	require.NoError(t, registry.Register("bp", id.Public))
+
+	now := time.Now()
+	announce := tracker.SignedAnnounce{InfoHash: testInfoHash, Port: 4000, Timestamp: now}
+	copy(announce.PeerID[:], "-RBT0001-peer-one---")
+	// The announce with one of its fields changed
+	with := func(change func(a *tracker.SignedAnnounce)) tracker.SignedAnnounce {
+		a := announce
+		change(&a)
+		return a
+	}
+	tooOld := with(func(a *tracker.SignedAnnounce) { a.Timestamp = now.Add(-2 * tracker.MaxClockSkew) })
+	fromTheFuture := with(func(a *tracker.SignedAnnounce) { a.Timestamp = now.Add(2 * tracker.MaxClockSkew) })
+	for _, c := range []struct {
+		name     string
+		sig      []byte
+		received tracker.SignedAnnounce
+		want     error
+	}{
+		{"other key", other.Sign(announce), announce, tracker.ErrBadSignature},
+		{"other info hash", id.Sign(with(func(a *tracker.SignedAnnounce) { a.InfoHash = metainfo.HashBytes([]byte("other")) })), announce, tracker.ErrBadSignature},
+		{"other peer id", id.Sign(with(func(a *tracker.SignedAnnounce) { copy(a.PeerID[:], "-RBT0001-peer-two---") })), announce, tracker.ErrBadSignature},
+		{"other port", id.Sign(with(func(a *tracker.SignedAnnounce) { a.Port = 4001 })), announce, tracker.ErrBadSignature},
+		{"other event", id.Sign(announce), with(func(a *tracker.SignedAnnounce) { a.Event = "stopped" }), tracker.ErrBadSignature},
+		{"other left", id.Sign(announce), with(func(a *tracker.SignedAnnounce) { a.Left = 1 }), tracker.ErrBadSignature},
+		{"other timestamp", id.Sign(announce), with(func(a *tracker.SignedAnnounce) { a.Timestamp = now.Add(time.Second) }), tracker.ErrBadSignature},
+		{"too old", id.Sign(tooOld), tooOld, tracker.ErrStaleTimestamp},
+		{"from the future", id.Sign(fromTheFuture), fromTheFuture, tracker.ErrStaleTimestamp},
+	} {
+		_, err := registry.Verify(c.received, id.Public, c.sig, now)
+		require.ErrorIs(t, err, c.want, c.name)
+	}
+
+	// A valid signature is accepted once, and no older one after it
+	name, err := registry.Verify(announce, id.Public, id.Sign(announce), now)
+	require.NoError(t, err)
+	require.Equal(t, "bp", name)
+	_, err = registry.Verify(announce, id.Public, id.Sign(announce), now)
+	require.ErrorIs(t, err, tracker.ErrStaleTimestamp, "replayed")
+	earlier := with(func(a *tracker.SignedAnnounce) { a.Timestamp = now.Add(-time.Second) })
+	_, err = registry.Verify(earlier, id.Public, id.Sign(earlier), now)
+	require.ErrorIs(t, err, tracker.ErrStaleTimestamp, "older than the last one")
+
+	// The same goes over the wire: a signed announce sent twice is rejected the second time
+	testTracker := utils.StartTrackerWithConfig(t, tracker.Config{RequireIdentity: true})
+	require.NoError(t, testTracker.Registry.Register("bp", id.Public))
+	req := signedAnnounceRequest(4000, &id)
+	req.SignedAt = time.Now()
+	_, err = tracker.Announce(testTracker.AnnounceURL(), req)
+	require.NoError(t, err)
+	_, err = tracker.Announce(testTracker.AnnounceURL(), req)
+	require.ErrorContains(t, err, tracker.ErrStaleTimestamp.Error())
+}
+
+// Test whether the address of a peer signing with a registered key only accepts announces signed with that key: unsigned
+// ones under any peer id or signed with another registered key are rejected, the latter without using up its
+// timestamp, while a signed one may stop it even under a new peer id.
+func TestRegistrySignedHolder(t *testing.T) {
+	t.Parallel()
+	testTracker := utils.StartTrackerWithConfig(t, tracker.Config{RequireIdentity: true})
+	id, other := newIdentity(t, testTracker, "bp"), newIdentity(t, testTracker, "other")
+	signed := signedAnnounceRequest(4000, id)
+	_, err := tracker.Announce(testTracker.AnnounceURL(), signed)
+	require.NoError(t, err)
+
+	unsigned := signed
+	unsigned.Identity = nil
+	stopped := unsigned
+	stopped.Event = "stopped"
+	stopped.Uploaded = 1 << 40
+	restarted := unsigned
+	copy(restarted.PeerID[:], "-RESTART-")
+	for _, req := range []tracker.AnnounceRequest{unsigned, stopped, restarted} {
+		_, err = tracker.Announce(testTracker.AnnounceURL(), req)
+		require.ErrorContains(t, err, "not signed with its key")
+	}
+	// Signed ahead of the clock, which would keep the other key from signing until then if it was used up
+	otherSigned := signed
+	otherSigned.Identity, otherSigned.SignedAt = other, time.Now().Add(tracker.MaxClockSkew/2)
+	_, err = tracker.Announce(testTracker.AnnounceURL(), otherSigned)
+	require.ErrorContains(t, err, "not signed with its key")
+	_, err = tracker.Announce(testTracker.AnnounceURL(), signedAnnounceRequest(4001, other))
+	require.NoError(t, err)
+	bp, ok := testTracker.BaselineProvider(testInfoHash)
+	require.True(t, ok)
+	require.Equal(t, []byte(id.Public), []byte(bp.Key))
+
+	restarted.Identity = id
+	restarted.Event = "stopped"
+	_, err = tracker.Announce(testTracker.AnnounceURL(), restarted)
+	require.NoError(t, err)
+	bp, ok = testTracker.BaselineProvider(testInfoHash)
+	require.True(t, ok)
+	require.Equal(t, 4001, bp.Port, "stopped baseline provider still promoted")
+}
+
+// Starts with a seeder, a baseline provider announcing through a signing proxy and a leecher, with a tracker trusting
+// baseline providers by key alone, plus an impostor on a port the tracker trusts. Then rotates the key of the
+// baseline provider, and finally revokes it.
+// Expectation: the signed baseline provider is promoted and the impostor is not; after the rotation the baseline
+// provider is promoted again under its new key, and once revoked it is demoted.
+func TestSignedBaselineProvider(t *testing.T) {
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		FileSize:                1e7,
+		Seeders:                 1,
+		BaselineProviderPorts:   []int{0},
+		Leechers:                1,
+		SignedBaselineProviders: true,
+		WaitPromoted:            true,
+		SmallInterval:           true,
+	})
+	bp := swarm.BaselineProvider(0)
+	require.NotNil(t, bp.Signer)
+	impostor := swarm.AddImpostor(0)
+	swarm.Tracker.TrustPort(impostor.Client.LocalPort())
+
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+	requirePromoted(t, swarm, bp)
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Leecher), []int{bp.Client.LocalPort()})
+	utils.VerifyNotFavored(t, swarm, impostor, swarm.Peers(utils.Leecher))
+
+	infoHash := swarm.MetaInfo.HashInfoBytes()
+	rotated, err := tracker.NewIdentity()
+	require.NoError(t, err)
+	require.NoError(t, swarm.Tracker.Registry.Rotate(bp.String(), rotated.Public))
+	bp.Signer.SetIdentity(rotated)
+	require.Eventually(t, func() bool {
+		promoted, ok := swarm.Tracker.BaselineProvider(infoHash)
+		return ok && string(promoted.Key) == string(rotated.Public)
+	}, 5*tracker.DefaultInterval, 100*time.Millisecond, "baseline provider not promoted under its new key")
+
+	require.NoError(t, swarm.Tracker.Registry.Revoke(bp.String()))
+	_, ok := swarm.Tracker.BaselineProvider(infoHash)
+	require.False(t, ok, "revoked baseline provider still promoted")
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+}
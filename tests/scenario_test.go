@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"net"
+	"path/filepath"
+	"rbtValidation/utils"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Run every scenario file (YAML or JSON) found in ./scenarios as a subtest named after the scenario.
+// A single one can be picked with e.g. `go test ./tests -run TestScenarios/<name>`.
+func TestScenarios(t *testing.T) {
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join("scenarios", pattern))
+		require.NoError(t, err)
+		paths = append(paths, matches...)
+	}
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		scenario, err := utils.LoadScenario(path)
+		require.NoError(t, err, "loading scenario %s", path)
+		t.Run(scenario.Name, func(t *testing.T) {
+			utils.RunScenario(t, scenario)
+		})
+	}
+}
+
+// Run a scenario whose initial seeder and leecher ask for listen ports of their own.
+// Expectation: each of them listens on its port.
+func TestScenarioPeerPorts(t *testing.T) {
+	seederPort, leecherPort := utils.FreePort(t), utils.FreePort(t)
+	utils.RunScenario(t, utils.Scenario{
+		Name:     "peer_ports",
+		FileSize: 1e6,
+		Peers: []utils.ScenarioPeer{
+			{Name: "seeder", Role: "seeder", Port: seederPort},
+			{Name: "leecher", Role: "leecher", Port: leecherPort},
+		},
+		Timeline: []utils.ScenarioEvent{{Action: utils.ActionDownload}},
+	})
+	for _, port := range []int{seederPort, leecherPort} {
+		conn, err := net.Dial("tcp", net.JoinHostPort(utils.Localhost, strconv.Itoa(port)))
+		require.NoError(t, err, "nothing listens on port %d", port)
+		conn.Close()
+	}
+}
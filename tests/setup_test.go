@@ -1,9 +1,12 @@
 package tests
 
 import (
+	"path/filepath"
+	"rbtValidation/utils"
 	"testing"
 
 	rbt "github.com/anacrolix/torrent"
+	"github.com/stretchr/testify/require"
 )
 
 // Verifies whether local copy of the reliableBT client repo is in use.
@@ -16,3 +19,21 @@ func TestClientSetup(t *testing.T) {
 		t.Errorf("got %s, wanted %s", ret, exp)
 	}
 }
+
+// Test whether peers keep their data under a directory of their own test, removed once the test finishes.
+func TestDataDirs(t *testing.T) {
+	seeder, leecher := utils.SeederConfig(t, 0, 0), utils.LeecherConfig(t, 0, 0)
+	require.Equal(t, utils.TestDataDir(t), filepath.Dir(seeder.DataDir))
+	require.Equal(t, filepath.Dir(seeder.DataDir), filepath.Dir(leecher.DataDir))
+	require.NotEqual(t, seeder.DataDir, leecher.DataDir)
+	require.Contains(t, seeder.DataDir, t.Name())
+
+	var subDir string
+	t.Run("sub test", func(t *testing.T) {
+		subDir = utils.TestDataDir(t)
+		require.Contains(t, filepath.Base(subDir), "TestDataDirs_sub_test")
+		utils.CreateDir(t, utils.PeerDataDir(t, "seeder", 0))
+	})
+	require.NotEqual(t, utils.TestDataDir(t), subDir)
+	require.NoDirExists(t, subDir)
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"net"
+	"rbtValidation/tracker"
+	"rbtValidation/utils"
+	"strconv"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+var testInfoHash = metainfo.HashBytes([]byte(utils.TestFileName))
+
+// Create a hand-made announce for a peer on the given port.
+func announceRequest(port int, left int64, reliable bool) tracker.AnnounceRequest {
+	req := tracker.AnnounceRequest{InfoHash: testInfoHash, Port: port, Left: left, Reliable: reliable}
+	copy(req.PeerID[:], metainfo.HashBytes([]byte{byte(port >> 8), byte(port)}).Bytes())
+	return req
+}
+
+// Test whether the tracker hands out the other peers of the swarm, but not the announcing peer itself.
+func TestTrackerAnnounce(t *testing.T) {
+	t.Parallel()
+	testTracker := utils.StartTracker(t)
+
+	resp, err := tracker.Announce(testTracker.AnnounceURL(), announceRequest(3000, 0, false))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, resp.Interval)
+	require.Empty(t, resp.Peers)
+
+	resp, err = tracker.Announce(testTracker.AnnounceURL(), announceRequest(3001, 100, false))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, resp.Complete)
+	require.EqualValues(t, 1, resp.Incomplete)
+	require.Len(t, resp.Peers, 6)
+	ip, port, err := tracker.ParseCompactAddr(resp.Peers)
+	require.NoError(t, err)
+	require.True(t, ip.Equal(net.ParseIP(utils.Localhost)))
+	require.Equal(t, 3000, port)
+	require.Empty(t, resp.BaselineProvider)
+
+	// A stopped peer should no longer be handed out
+	req := announceRequest(3000, 0, false)
+	req.Event = "stopped"
+	_, err = tracker.Announce(testTracker.AnnounceURL(), req)
+	require.NoError(t, err)
+	resp, err = tracker.Announce(testTracker.AnnounceURL(), announceRequest(3001, 100, false))
+	require.NoError(t, err)
+	require.Empty(t, resp.Peers)
+}
+
+// Test whether a complete, reliable peer on a trusted port is promoted to everyone but itself.
+func TestTrackerPromotesTrustedBaselineProvider(t *testing.T) {
+	t.Parallel()
+	testTracker := utils.StartTracker(t, 4000)
+
+	resp, err := tracker.Announce(testTracker.AnnounceURL(), announceRequest(4000, 0, true))
+	require.NoError(t, err)
+	require.Empty(t, resp.BaselineProvider)
+
+	resp, err = tracker.Announce(testTracker.AnnounceURL(), announceRequest(3001, 100, false))
+	require.NoError(t, err)
+	ip, port, err := tracker.ParseCompactAddr(resp.BaselineProvider)
+	require.NoError(t, err)
+	require.True(t, ip.Equal(net.ParseIP(utils.Localhost)))
+	require.Equal(t, 4000, port)
+
+	bp, ok := testTracker.BaselineProvider(testInfoHash)
+	require.True(t, ok)
+	require.Equal(t, 4000, bp.Port)
+}
+
+// Test whether reliable peers are not promoted if they are on an untrusted port, or do not have the complete file yet.
+func TestTrackerIgnoresUnqualifiedBaselineProvider(t *testing.T) {
+	t.Parallel()
+	testTracker := utils.StartTracker(t, 4000)
+
+	_, err := tracker.Announce(testTracker.AnnounceURL(), announceRequest(4500, 0, true))
+	require.NoError(t, err)
+	_, err = tracker.Announce(testTracker.AnnounceURL(), announceRequest(4000, 100, true))
+	require.NoError(t, err)
+	resp, err := tracker.Announce(testTracker.AnnounceURL(), announceRequest(3001, 100, false))
+	require.NoError(t, err)
+	require.Empty(t, resp.BaselineProvider)
+	_, ok := testTracker.BaselineProvider(testInfoHash)
+	require.False(t, ok)
+
+	// Once the trusted one completes, it gets promoted
+	_, err = tracker.Announce(testTracker.AnnounceURL(), announceRequest(4000, 0, true))
+	require.NoError(t, err)
+	bp, ok := testTracker.BaselineProvider(testInfoHash)
+	require.True(t, ok)
+	require.Equal(t, 4000, bp.Port)
+}
+
+// Test whether a recording proxy in front of the tracker records each announce as sent, and passes the response back.
+func TestRecordingProxy(t *testing.T) {
+	t.Parallel()
+	testTracker := utils.StartTracker(t)
+	proxy, err := tracker.NewRecordingProxy(testTracker.AnnounceURL())
+	require.NoError(t, err)
+	defer proxy.Close()
+
+	req := announceRequest(3000, 100, true)
+	req.Uploaded, req.Downloaded, req.Event = 10, 20, "started"
+	_, err = tracker.Announce(proxy.AnnounceURL(), req)
+	require.NoError(t, err)
+	resp, err := tracker.Announce(proxy.AnnounceURL(), announceRequest(3001, 0, false))
+	require.NoError(t, err)
+	require.Len(t, resp.Peers, 6)
+
+	// Both the proxy and the tracker behind it should have recorded the same announces
+	for _, recorder := range []*tracker.Recorder{&proxy.Recorder, testTracker.Recorder} {
+		announcements := recorder.Announcements(testInfoHash)
+		require.Len(t, announcements, 2)
+		require.Equal(t, req.PeerID, announcements[0].ID)
+		require.Equal(t, 3000, announcements[0].Port)
+		require.Equal(t, "started", announcements[0].Event)
+		require.EqualValues(t, 100, announcements[0].Left)
+		require.EqualValues(t, 10, announcements[0].Uploaded)
+		require.EqualValues(t, 20, announcements[0].Downloaded)
+		require.True(t, announcements[0].Reliable)
+		require.Equal(t, 3001, announcements[1].Port)
+		require.Empty(t, announcements[1].Event)
+		require.False(t, announcements[1].Time.Before(announcements[0].Time))
+	}
+}
+
+// Test whether allocated ports are free and distinct, and a trusted one is trusted by the tracker alone.
+func TestTrustedPort(t *testing.T) {
+	t.Parallel()
+	testTracker := utils.StartTracker(t)
+	otherTracker := utils.StartTracker(t)
+
+	ports := append(utils.FreePorts(t, 3), utils.TrustedPort(t, testTracker))
+	seen := make(map[int]bool)
+	for _, port := range ports {
+		require.False(t, seen[port], "port %d allocated twice", port)
+		seen[port] = true
+		l, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+		require.NoError(t, err, "port %d not free", port)
+		l.Close()
+	}
+	for _, port := range ports[:3] {
+		require.False(t, testTracker.IsTrusted(port))
+	}
+	require.True(t, testTracker.IsTrusted(ports[3]))
+	require.False(t, otherTracker.IsTrusted(ports[3]))
+}
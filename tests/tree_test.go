@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"rbtValidation/utils"
+	"testing"
+	"time"
+)
+
+// Test whether a directory tree of files of varied sizes (empty ones, ones smaller than a piece and ones straddling
+// piece boundaries) is transferred from a seeder to leechers.
+func TestMultiFileSeederLeechers(t *testing.T) {
+	t.Parallel()
+	files := utils.VariedTree(utils.PieceLength)
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{Files: files, Seeders: 1, Leechers: 2, SmallInterval: true})
+
+	// Wait until transfer is complete
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+
+	// Verify every file of the tree, and the pieces spanning them
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+	utils.VerifyTree(t, utils.TestDirName, files, swarm.DataDirs(utils.Leecher))
+}
+
+// Starts with a throttled seeder and a baseline provider sharing a directory tree, and a leecher.
+// Expectation: the leecher gets most of the tree from the baseline provider, across file boundaries.
+func TestMultiFileBaselineProvider(t *testing.T) {
+	files := utils.VariedTree(utils.PieceLength)
+	baselineProviderPort := utils.FreePort(t)
+	swarm := utils.NewSwarm(t, utils.SwarmConfig{
+		Files:                 files,
+		Seeders:               1,
+		BaselineProviderPorts: []int{baselineProviderPort},
+		Leechers:              1,
+		Configure: func(p *utils.Peer) {
+			if p.Role == utils.Seeder {
+				p.Config.UploadRateLimiter = utils.SmallRateLimiter
+			}
+		},
+		WaitPromoted:  true,
+		SmallInterval: true,
+	})
+	baselineProvider, leecher := swarm.BaselineProvider(0), swarm.Leecher(0)
+
+	// Wait until transfer is complete
+	swarm.DownloadAll()
+	swarm.WaitLeechers()
+
+	// Verify the baseline provider supplied the bulk of the tree
+	utils.VerifyAttribution(t, swarm.Ledger, leecher.String(), utils.TreeSize(files))
+	utils.VerifyContribution(t, swarm.Ledger, leecher.String(), []string{baselineProvider.String()}, time.Time{}, 0.5)
+
+	// Verify baseline provider (baseline provider should not get itself as baseline provider)
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.Leecher), []int{baselineProviderPort})
+	utils.VerifyBaselineProvider(t, swarm.Torrents(utils.BaselineProvider), []int{})
+
+	// Verify every file of the tree
+	utils.VerifyPieces(t, &swarm.MetaInfo, swarm.DataDirs(utils.Leecher))
+	utils.VerifyTree(t, utils.TestDirName, files, swarm.DataDirs(utils.Leecher))
+}
@@ -0,0 +1,88 @@
+package tracker
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// The parameters of a hand-made announce, for tests that act as a peer without running a client.
+type AnnounceRequest struct {
+	InfoHash   metainfo.Hash
+	PeerID     [20]byte
+	Port       int
+	Uploaded   int64
+	Downloaded int64
+	Left       int64
+	Event      string
+	Reliable   bool
+	// Identity to sign the announce with (see Identity.SignQuery), unsigned if nil
+	Identity *Identity
+	// Time the announce is signed at, now if zero
+	SignedAt time.Time
+}
+
+// Send an announce to the tracker at the given announce URL and decode its response.
+func Announce(announceURL string, req AnnounceRequest) (resp AnnounceResponse, err error) {
+	u, err := url.Parse(announceURL)
+	if err != nil {
+		return
+	}
+	q := url.Values{}
+	q.Set("info_hash", string(req.InfoHash[:]))
+	q.Set("peer_id", string(req.PeerID[:]))
+	q.Set("port", strconv.Itoa(req.Port))
+	q.Set("uploaded", strconv.FormatInt(req.Uploaded, 10))
+	q.Set("downloaded", strconv.FormatInt(req.Downloaded, 10))
+	q.Set("left", strconv.FormatInt(req.Left, 10))
+	q.Set("compact", "1")
+	if req.Event != "" {
+		q.Set("event", req.Event)
+	}
+	if req.Reliable {
+		q.Set(ReliableParam, "1")
+	}
+	if req.Identity != nil {
+		signedAt := req.SignedAt
+		if signedAt.IsZero() {
+			signedAt = time.Now()
+		}
+		req.Identity.SignQuery(q, signedAt)
+	}
+	u.RawQuery = q.Encode()
+
+	httpResp, err := http.Get(u.String())
+	if err != nil {
+		return
+	}
+	defer httpResp.Body.Close()
+	b, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return
+	}
+	err = bencode.Unmarshal(b, &resp)
+	if err == nil && resp.FailureReason != "" {
+		err = fmt.Errorf("tracker failure: %s", resp.FailureReason)
+	}
+	return
+}
+
+// The request that sends the recorded announce again, as an attacker replaying it would.
+func (a Announcement) Request() AnnounceRequest {
+	return AnnounceRequest{
+		InfoHash:   a.InfoHash,
+		PeerID:     a.ID,
+		Port:       a.Port,
+		Uploaded:   a.Uploaded,
+		Downloaded: a.Downloaded,
+		Left:       a.Left,
+		Event:      a.Event,
+		Reliable:   a.Reliable,
+	}
+}
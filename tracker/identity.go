@@ -0,0 +1,282 @@
+package tracker
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	// Query parameters of a signed announce: the public key of the baseline provider (hex), the time of signing
+	// (Unix nanoseconds) and the signature over the fields of the announce in SignedAnnounce (hex).
+	KeyParam       = "bp_key"
+	TimestampParam = "bp_ts"
+	SignatureParam = "bp_sig"
+	// How far the timestamp of a signed announce may be from the time of the tracker.
+	MaxClockSkew = 30 * time.Second
+)
+
+// Reasons a signed announce is rejected.
+var (
+	ErrUnknownKey     = errors.New("unknown key")
+	ErrRevokedKey     = errors.New("revoked key")
+	ErrBadSignature   = errors.New("bad signature")
+	ErrStaleTimestamp = errors.New("stale timestamp")
+)
+
+// The key pair a baseline provider signs its announces with.
+type Identity struct {
+	Public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+// Generate a new identity.
+func NewIdentity() (id Identity, err error) {
+	id.Public, id.private, err = ed25519.GenerateKey(rand.Reader)
+	return
+}
+
+// The fields of an announce covered by its signature: whose it is, what it does to the peer's state (its port, event
+// and what it has left), and when it was signed, so none of them can be changed without the key.
+type SignedAnnounce struct {
+	InfoHash  metainfo.Hash
+	PeerID    [20]byte
+	Port      int
+	Event     string
+	Left      int64
+	Timestamp time.Time
+}
+
+// Sign the given announce.
+func (id Identity) Sign(a SignedAnnounce) []byte {
+	return ed25519.Sign(id.private, a.message())
+}
+
+// Add the key, timestamp and signature of the announce to its query, signed at the given time.
+func (id Identity) SignQuery(q url.Values, timestamp time.Time) {
+	a := SignedAnnounce{Event: q.Get("event"), Timestamp: timestamp}
+	copy(a.InfoHash[:], q.Get("info_hash"))
+	copy(a.PeerID[:], q.Get("peer_id"))
+	a.Port, _ = strconv.Atoi(q.Get("port"))
+	a.Left, _ = strconv.ParseInt(q.Get("left"), 10, 64)
+	q.Set(KeyParam, hex.EncodeToString(id.Public))
+	q.Set(TimestampParam, strconv.FormatInt(timestamp.UnixNano(), 10))
+	q.Set(SignatureParam, hex.EncodeToString(id.Sign(a)))
+}
+
+// The message signed for an announce: info hash, peer id, port (2 bytes), left and timestamp (Unix nanoseconds), both
+// 8 bytes, all big endian, then the event.
+func (a SignedAnnounce) message() []byte {
+	msg := make([]byte, 0, len(a.InfoHash)+len(a.PeerID)+2+8+8+len(a.Event))
+	msg = append(msg, a.InfoHash[:]...)
+	msg = append(msg, a.PeerID[:]...)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(a.Port))
+	msg = binary.BigEndian.AppendUint64(msg, uint64(a.Left))
+	msg = binary.BigEndian.AppendUint64(msg, uint64(a.Timestamp.UnixNano()))
+	return append(msg, a.Event...)
+}
+
+// The signature carried by an announce, see Identity.SignQuery.
+type signature struct {
+	key       ed25519.PublicKey
+	timestamp time.Time
+	sig       []byte
+}
+
+// Parse the signature of an announce, nil if it is not signed.
+func parseSignature(q url.Values) (s *signature, err error) {
+	if q.Get(KeyParam) == "" {
+		return
+	}
+	s = &signature{}
+	s.key, err = hex.DecodeString(q.Get(KeyParam))
+	if err != nil || len(s.key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid %s %q", KeyParam, q.Get(KeyParam))
+	}
+	nanos, err := strconv.ParseInt(q.Get(TimestampParam), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", TimestampParam, q.Get(TimestampParam))
+	}
+	s.timestamp = time.Unix(0, nanos)
+	s.sig, err = hex.DecodeString(q.Get(SignatureParam))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", SignatureParam, q.Get(SignatureParam))
+	}
+	return
+}
+
+// The baseline providers the tracker knows by public key, each under a name that outlives its keys.
+type Registry struct {
+	mu   sync.Mutex
+	keys map[string]*registeredKey
+}
+
+// A key registered for a baseline provider.
+type registeredKey struct {
+	name    string
+	revoked bool
+	// Timestamp of the last announce accepted with the key, so none can be replayed
+	last time.Time
+}
+
+// Create an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{keys: make(map[string]*registeredKey)}
+}
+
+// Register the key of the named baseline provider, which may already have others. Fails if the key is registered.
+func (r *Registry) Register(name string, key ed25519.PublicKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[string(key)]; ok {
+		return fmt.Errorf("key %x already registered", []byte(key))
+	}
+	r.keys[string(key)] = &registeredKey{name: name}
+	return nil
+}
+
+// Replace every key of the named baseline provider by the given one: announces signed with the others are rejected
+// from now on. Fails if the baseline provider has no key yet, or the key is registered.
+func (r *Registry) Rotate(name string, key ed25519.PublicKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[string(key)]; ok {
+		return fmt.Errorf("key %x already registered", []byte(key))
+	}
+	if r.revoke(name) == 0 {
+		return fmt.Errorf("no key registered for %q", name)
+	}
+	r.keys[string(key)] = &registeredKey{name: name}
+	return nil
+}
+
+// Revoke every key of the named baseline provider, demoting it wherever it was promoted.
+// Fails if it has no key to revoke.
+func (r *Registry) Revoke(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.revoke(name) == 0 {
+		return fmt.Errorf("no key registered for %q", name)
+	}
+	return nil
+}
+
+// Revoke every key of the name, returning how many were still valid.
+// Must be called with the registry lock held.
+func (r *Registry) revoke(name string) (n int) {
+	for _, k := range r.keys {
+		if k.name == name && !k.revoked {
+			k.revoked = true
+			n++
+		}
+	}
+	return
+}
+
+// The name of the baseline provider the key is registered for, if it is and is not revoked.
+func (r *Registry) Trusted(key ed25519.PublicKey) (name string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, found := r.keys[string(key)]
+	if !found || k.revoked {
+		return "", false
+	}
+	return k.name, true
+}
+
+// Check the signature of an announce received at the given time, and accept it: the key must be registered and not
+// revoked, the signature valid over the announce, and its timestamp within MaxClockSkew of now and later than the one
+// of any announce accepted before with the key. Returns the name of the baseline provider.
+func (r *Registry) Verify(a SignedAnnounce, key ed25519.PublicKey, sig []byte, now time.Time) (name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[string(key)]
+	if !ok {
+		return "", fmt.Errorf("%w %x", ErrUnknownKey, []byte(key))
+	}
+	if k.revoked {
+		return "", fmt.Errorf("%w %x of %q", ErrRevokedKey, []byte(key), k.name)
+	}
+	if !ed25519.Verify(key, a.message(), sig) {
+		return "", fmt.Errorf("%w from %q", ErrBadSignature, k.name)
+	}
+	if skew := now.Sub(a.Timestamp); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return "", fmt.Errorf("%w from %q: %v off", ErrStaleTimestamp, k.name, skew)
+	}
+	if !a.Timestamp.After(k.last) {
+		return "", fmt.Errorf("%w from %q: not after the last one accepted", ErrStaleTimestamp, k.name)
+	}
+	k.last = a.Timestamp
+	return k.name, nil
+}
+
+// An HTTP reverse proxy signing the announces of a baseline provider with its identity, for a client that cannot sign
+// them itself: the baseline provider announces to its AnnounceURL instead of the tracker's.
+type SigningProxy struct {
+	mu       sync.Mutex
+	identity Identity
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// Start a signing proxy on a free localhost port, forwarding to the tracker at the given announce URL.
+func NewSigningProxy(announceURL string, identity Identity) (proxy *SigningProxy, err error) {
+	target, err := url.Parse(announceURL)
+	if err != nil {
+		return
+	}
+	proxy = &SigningProxy{identity: identity}
+	proxy.listener, err = net.Listen("tcp", net.JoinHostPort(localhost, "0"))
+	if err != nil {
+		return nil, err
+	}
+	target.Path = ""
+	reverseProxy := httputil.NewSingleHostReverseProxy(target)
+	direct := reverseProxy.Director
+	reverseProxy.Director = func(r *http.Request) {
+		direct(r)
+		q := r.URL.Query()
+		proxy.Identity().SignQuery(q, time.Now())
+		r.URL.RawQuery = q.Encode()
+	}
+	proxy.server = &http.Server{Handler: reverseProxy}
+	go proxy.server.Serve(proxy.listener)
+	return
+}
+
+// The identity announces are signed with.
+func (proxy *SigningProxy) Identity() Identity {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	return proxy.identity
+}
+
+// Sign announces with another identity from now on, as after a key rotation.
+func (proxy *SigningProxy) SetIdentity(identity Identity) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.identity = identity
+}
+
+// The announce URL the baseline provider should use to go through the proxy.
+func (proxy *SigningProxy) AnnounceURL() string {
+	return "http://" + proxy.listener.Addr().String() + "/announce"
+}
+
+// Stop forwarding announces.
+func (proxy *SigningProxy) Close() error {
+	return proxy.server.Close()
+}
@@ -0,0 +1,128 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const localhost = "127.0.0.1"
+
+// Parse the info hash, the announcing peer and the event out of an announce request.
+func parseAnnounce(r *http.Request) (infoHash metainfo.Hash, p *Peer, event string, err error) {
+	q := r.URL.Query()
+
+	rawInfoHash := q.Get("info_hash")
+	if len(rawInfoHash) != len(infoHash) {
+		err = fmt.Errorf("invalid info_hash of length %d", len(rawInfoHash))
+		return
+	}
+	copy(infoHash[:], rawInfoHash)
+
+	p = &Peer{LastAnnounce: time.Now()}
+	rawPeerID := q.Get("peer_id")
+	if len(rawPeerID) != len(p.ID) {
+		err = fmt.Errorf("invalid peer_id of length %d", len(rawPeerID))
+		return
+	}
+	copy(p.ID[:], rawPeerID)
+
+	p.Port, err = strconv.Atoi(q.Get("port"))
+	if err != nil || p.Port <= 0 || p.Port > 65535 {
+		err = fmt.Errorf("invalid port %q", q.Get("port"))
+		return
+	}
+
+	// Fall back to the address the request came from if the peer does not report its IP
+	p.IP = net.ParseIP(q.Get("ip")).To4()
+	if p.IP == nil {
+		host, _, splitErr := net.SplitHostPort(r.RemoteAddr)
+		if splitErr != nil {
+			err = splitErr
+			return
+		}
+		p.IP = net.ParseIP(host).To4()
+	}
+	if p.IP == nil {
+		err = errors.New("only IPv4 peers are supported")
+		return
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *int64
+	}{
+		{"uploaded", &p.Uploaded},
+		{"downloaded", &p.Downloaded},
+		{"left", &p.Left},
+	} {
+		*field.value, err = strconv.ParseInt(q.Get(field.name), 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid %s %q", field.name, q.Get(field.name))
+			return
+		}
+	}
+
+	p.Reliable, _ = strconv.ParseBool(q.Get(ReliableParam))
+	sig, err := parseSignature(q)
+	if err != nil {
+		return
+	}
+	if sig != nil {
+		p.Key = sig.key
+	}
+	event = q.Get("event")
+	return
+}
+
+// Encode an IPv4 address and port in the compact form of BEP 23.
+func compactAddr(ip net.IP, port int) []byte {
+	b := make([]byte, 6)
+	copy(b, ip.To4())
+	binary.BigEndian.PutUint16(b[4:], uint16(port))
+	return b
+}
+
+// Decode an IPv4 address and port in the compact form of BEP 23.
+func ParseCompactAddr(b []byte) (ip net.IP, port int, err error) {
+	if len(b) != 6 {
+		err = fmt.Errorf("compact address of length %d", len(b))
+		return
+	}
+	ip = net.IPv4(b[0], b[1], b[2], b[3])
+	port = int(binary.BigEndian.Uint16(b[4:]))
+	return
+}
+
+// The key identifying a peer within a swarm.
+func peerKey(ip net.IP, port int) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// Close the connection of a request without writing any response, as if the tracker could not be reached.
+func dropConnection(w http.ResponseWriter) {
+	if hijacker, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+	panic(http.ErrAbortHandler)
+}
+
+func writeResponse(w http.ResponseWriter, resp AnnounceResponse) {
+	b, err := bencode.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(b)
+}
@@ -0,0 +1,127 @@
+package tracker
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// An announce as sent by a peer, before the tracker handles it.
+type Announcement struct {
+	InfoHash metainfo.Hash
+	// Event of the announce ("started", "stopped", "completed"), empty for a regular one
+	Event string
+	Time  time.Time
+	// The announcing peer, with the progress it reported
+	Peer
+}
+
+// Records every announce passing through it, so tests can assert on them instead of capturing traffic.
+type Recorder struct {
+	mu            sync.Mutex
+	announcements []Announcement
+}
+
+// Record the announces handled by next. Requests that are not valid announces are passed on without being recorded.
+func (rec *Recorder) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if infoHash, p, event, err := parseAnnounce(r); err == nil {
+			rec.mu.Lock()
+			rec.announcements = append(rec.announcements, Announcement{
+				InfoHash: infoHash,
+				Event:    event,
+				Time:     p.LastAnnounce,
+				Peer:     *p,
+			})
+			rec.mu.Unlock()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Return the announces recorded for the given info hash, in the order they were received.
+func (rec *Recorder) Announcements(infoHash metainfo.Hash) (announcements []Announcement) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, a := range rec.announcements {
+		if a.InfoHash == infoHash {
+			announcements = append(announcements, a)
+		}
+	}
+	return
+}
+
+// Group the announces recorded for the given info hash by the listen port of the announcing peer.
+func (rec *Recorder) ByPort(infoHash metainfo.Hash) map[int][]Announcement {
+	byPort := make(map[int][]Announcement)
+	for _, a := range rec.Announcements(infoHash) {
+		byPort[a.Port] = append(byPort[a.Port], a)
+	}
+	for _, announcements := range byPort {
+		sort.SliceStable(announcements, func(i, j int) bool { return announcements[i].Time.Before(announcements[j].Time) })
+	}
+	return byPort
+}
+
+// Group the announces recorded for the given info hash by the peer id of the announcing peer, which unlike its port
+// is still reported once the peer stopped listening.
+func (rec *Recorder) ByPeerID(infoHash metainfo.Hash) map[[20]byte][]Announcement {
+	byPeerID := make(map[[20]byte][]Announcement)
+	for _, a := range rec.Announcements(infoHash) {
+		byPeerID[a.ID] = append(byPeerID[a.ID], a)
+	}
+	for _, announcements := range byPeerID {
+		sort.SliceStable(announcements, func(i, j int) bool { return announcements[i].Time.Before(announcements[j].Time) })
+	}
+	return byPeerID
+}
+
+// Forget every recorded announce.
+func (rec *Recorder) Clear() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.announcements = nil
+}
+
+// An HTTP reverse proxy recording the announces sent to another tracker (e.g. an external one),
+// peers should announce to its AnnounceURL instead of the tracker's.
+type RecordingProxy struct {
+	Recorder
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// Start a recording proxy on a free localhost port, forwarding to the tracker at the given announce URL.
+func NewRecordingProxy(announceURL string) (proxy *RecordingProxy, err error) {
+	target, err := url.Parse(announceURL)
+	if err != nil {
+		return
+	}
+	proxy = &RecordingProxy{}
+	proxy.listener, err = net.Listen("tcp", net.JoinHostPort(localhost, "0"))
+	if err != nil {
+		return nil, err
+	}
+	// Keep the path of the request, peers announce to the same path on the proxy as on the tracker
+	target.Path = ""
+	proxy.server = &http.Server{Handler: proxy.Wrap(httputil.NewSingleHostReverseProxy(target))}
+	go proxy.server.Serve(proxy.listener)
+	return
+}
+
+// The announce URL peers should use to go through the proxy.
+func (proxy *RecordingProxy) AnnounceURL() string {
+	return "http://" + proxy.listener.Addr().String() + "/announce"
+}
+
+// Stop forwarding announces.
+func (proxy *RecordingProxy) Close() error {
+	return proxy.server.Close()
+}
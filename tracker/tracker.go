@@ -0,0 +1,410 @@
+package tracker
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	// Announce interval handed out by default, peers with SmallIntervalAllowed follow it as is.
+	DefaultInterval = time.Second
+	// Number of peers returned per announce if the peer does not ask for a specific amount.
+	DefaultNumWant = 50
+	// Query parameter set by a reliable client (config.Reliable) to claim baseline provider status.
+	ReliableParam = "reliable"
+)
+
+// Configuration of an in-process tracker.
+type Config struct {
+	// Announce interval returned to peers, DefaultInterval if zero.
+	Interval time.Duration
+	// Peers that have not announced within this duration are dropped from the swarm, never if zero. This is the only
+	// way a trusted port is released for another peer id, see Tracker.check.
+	PeerTimeout time.Duration
+	// Listen ports of peers trusted to act as baseline providers.
+	TrustedPorts []int
+	// Trust baseline providers by their key registered with Tracker.Registry alone, not by their port.
+	RequireIdentity bool
+}
+
+// A peer as last announced to the tracker.
+type Peer struct {
+	ID           [20]byte
+	IP           net.IP
+	Port         int
+	Uploaded     int64
+	Downloaded   int64
+	Left         int64
+	Reliable     bool
+	LastAnnounce time.Time
+	// Public key the announce is signed with, nil if unsigned (see Identity.SignQuery).
+	// Only verified for the peers of a swarm, not for recorded announces.
+	Key ed25519.PublicKey
+}
+
+// The bencoded body of an announce response.
+type AnnounceResponse struct {
+	FailureReason string `bencode:"failure reason,omitempty"`
+	Interval      int32  `bencode:"interval"`
+	MinInterval   int32  `bencode:"min interval"`
+	Complete      int32  `bencode:"complete"`
+	Incomplete    int32  `bencode:"incomplete"`
+	Peers         []byte `bencode:"peers"`
+	// The promoted baseline provider in compact form, see ParseCompactAddr
+	BaselineProvider []byte `bencode:"baseline provider,omitempty"`
+}
+
+// Rewrites the address of a peer as handed out to another peer (e.g. to route their connection through a proxy).
+// The address of the promoted baseline provider is rewritten as well, so a peer knows it by the address it was handed
+// for it and reaches it the same way as any other peer.
+type AddrMapper func(to Peer, peer Peer) (ip net.IP, port int)
+
+// All peers announcing for one info hash, along with the baseline provider promoted to them.
+type swarm struct {
+	peers            map[string]*Peer
+	baselineProvider *Peer
+}
+
+// An HTTP tracker running inside the test process, standing in for the reliableBT tracker.
+// Each instance keeps its own swarm state, so every test starts from a clean slate.
+type Tracker struct {
+	// Every announce received, including the ones dropped for blocked ports
+	Recorder *Recorder
+	// Baseline providers trusted by their public key
+	Registry *Registry
+
+	config Config
+
+	mu           sync.Mutex
+	swarms       map[metainfo.Hash]*swarm
+	trustedPorts map[int]bool
+	addrMapper   AddrMapper
+	blockedPorts map[int]bool
+	// Address named as baseline provider in every response, see Tracker.ForgeBaselineProvider
+	forgedBaselineProvider []byte
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// Create a tracker with the given configuration, call Start to begin serving announces.
+func New(config Config) *Tracker {
+	if config.Interval == 0 {
+		config.Interval = DefaultInterval
+	}
+	tr := &Tracker{
+		Recorder:     &Recorder{},
+		Registry:     NewRegistry(),
+		config:       config,
+		swarms:       make(map[metainfo.Hash]*swarm),
+		trustedPorts: make(map[int]bool),
+		blockedPorts: make(map[int]bool),
+	}
+	for _, port := range config.TrustedPorts {
+		tr.trustedPorts[port] = true
+	}
+	return tr
+}
+
+// Start serving announces on a free localhost port.
+func (tr *Tracker) Start() (err error) {
+	tr.listener, err = net.Listen("tcp", net.JoinHostPort(localhost, "0"))
+	if err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/announce", tr.Recorder.Wrap(http.HandlerFunc(tr.handleAnnounce)))
+	tr.server = &http.Server{Handler: mux}
+	go tr.server.Serve(tr.listener)
+	return
+}
+
+// Stop serving announces, dropping all swarm state.
+func (tr *Tracker) Close() error {
+	tr.Reset()
+	if tr.server == nil {
+		return nil
+	}
+	return tr.server.Close()
+}
+
+// The address the tracker is listening on.
+func (tr *Tracker) Addr() net.Addr {
+	return tr.listener.Addr()
+}
+
+// The announce URL to be put into the metainfo of torrents using this tracker.
+func (tr *Tracker) AnnounceURL() string {
+	return fmt.Sprintf("http://%s/announce", tr.Addr())
+}
+
+// Drop all swarm state, as restarting the tracker would.
+func (tr *Tracker) Reset() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.swarms = make(map[metainfo.Hash]*swarm)
+}
+
+// Trust peers listening on the given port to act as baseline providers.
+func (tr *Tracker) TrustPort(port int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.trustedPorts[port] = true
+}
+
+// Stop trusting peers listening on the given port, demoting any of them that is currently promoted.
+func (tr *Tracker) DistrustPort(port int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	delete(tr.trustedPorts, port)
+	for _, s := range tr.swarms {
+		tr.promote(s)
+	}
+}
+
+// Rewrite the peer addresses handed out from now on with the given mapper, or stop rewriting them if nil.
+func (tr *Tracker) SetAddrMapper(mapper AddrMapper) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.addrMapper = mapper
+}
+
+// Make the tracker unreachable for peers listening on the given ports: their announces are dropped without any response.
+func (tr *Tracker) Block(ports ...int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for _, port := range ports {
+		tr.blockedPorts[port] = true
+	}
+}
+
+// Make the tracker reachable again for peers listening on the given ports, or for everyone if none is given.
+func (tr *Tracker) Unblock(ports ...int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if len(ports) == 0 {
+		tr.blockedPorts = make(map[int]bool)
+	}
+	for _, port := range ports {
+		delete(tr.blockedPorts, port)
+	}
+}
+
+// Name the given address as the baseline provider in every response from now on, whether any peer listens there or
+// not, as a compromised tracker would; nil goes back to naming the promoted one. Tracker.BaselineProvider still
+// returns the peer actually promoted.
+func (tr *Tracker) ForgeBaselineProvider(ip net.IP, port int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if ip == nil {
+		tr.forgedBaselineProvider = nil
+		return
+	}
+	tr.forgedBaselineProvider = compactAddr(ip, port)
+}
+
+// Whether peers listening on the given port are trusted to act as baseline providers.
+func (tr *Tracker) IsTrusted(port int) bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.trustedPorts[port]
+}
+
+// Return a snapshot of the peers in the swarm of the given info hash, ordered by port.
+func (tr *Tracker) Peers(infoHash metainfo.Hash) (peers []Peer) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	s, ok := tr.swarms[infoHash]
+	if !ok {
+		return
+	}
+	tr.expire(s)
+	for _, p := range s.peers {
+		peers = append(peers, *p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Port < peers[j].Port })
+	return
+}
+
+// Return the baseline provider currently promoted for the given info hash, if any.
+func (tr *Tracker) BaselineProvider(infoHash metainfo.Hash) (bp Peer, ok bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	s, found := tr.swarms[infoHash]
+	if !found {
+		return
+	}
+	tr.expire(s)
+	tr.promote(s)
+	if s.baselineProvider == nil {
+		return
+	}
+	return *s.baselineProvider, true
+}
+
+func (tr *Tracker) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	infoHash, p, event, err := parseAnnounce(r)
+	if err != nil {
+		writeResponse(w, AnnounceResponse{FailureReason: err.Error()})
+		return
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.blockedPorts[p.Port] {
+		dropConnection(w)
+		return
+	}
+	s, ok := tr.swarms[infoHash]
+	if !ok {
+		s = &swarm{peers: make(map[string]*Peer)}
+		tr.swarms[infoHash] = s
+	}
+	key := peerKey(p.IP, p.Port)
+	requester := *p
+	// A holder that timed out no longer holds its address
+	tr.expire(s)
+	if err := tr.check(s.peers[key], p, event); err != nil {
+		writeResponse(w, AnnounceResponse{FailureReason: err.Error()})
+		return
+	}
+	// Verify the signature last, so the key only moves past the timestamp of an announce that is accepted
+	if sig, _ := parseSignature(r.URL.Query()); sig != nil {
+		signed := SignedAnnounce{InfoHash: infoHash, PeerID: p.ID, Port: p.Port, Event: event, Left: p.Left, Timestamp: sig.timestamp}
+		if _, err := tr.Registry.Verify(signed, sig.key, sig.sig, p.LastAnnounce); err != nil {
+			writeResponse(w, AnnounceResponse{FailureReason: err.Error()})
+			return
+		}
+	}
+	if event == "stopped" {
+		delete(s.peers, key)
+	} else if existing, ok := s.peers[key]; ok {
+		// Update in place, so a promoted baseline provider stays promoted across its announces
+		*existing = *p
+	} else {
+		s.peers[key] = p
+	}
+	tr.expire(s)
+	tr.promote(s)
+
+	numWant := DefaultNumWant
+	if v, err := strconv.Atoi(r.URL.Query().Get("numwant")); err == nil && v >= 0 {
+		numWant = v
+	}
+	resp := AnnounceResponse{
+		Interval:    int32(tr.config.Interval / time.Second),
+		MinInterval: int32(tr.config.Interval / time.Second),
+	}
+	for k, other := range s.peers {
+		if other.Left == 0 {
+			resp.Complete++
+		} else {
+			resp.Incomplete++
+		}
+		if k == key || numWant == 0 {
+			continue
+		}
+		ip, port := other.IP, other.Port
+		if tr.addrMapper != nil {
+			ip, port = tr.addrMapper(requester, *other)
+		}
+		resp.Peers = append(resp.Peers, compactAddr(ip, port)...)
+		numWant--
+	}
+	// The baseline provider should not be told about itself
+	if bp := s.baselineProvider; bp != nil && peerKey(bp.IP, bp.Port) != key {
+		ip, port := bp.IP, bp.Port
+		if tr.addrMapper != nil {
+			ip, port = tr.addrMapper(requester, *bp)
+		}
+		resp.BaselineProvider = compactAddr(ip, port)
+	}
+	if tr.forgedBaselineProvider != nil {
+		resp.BaselineProvider = tr.forgedBaselineProvider
+	}
+	writeResponse(w, resp)
+}
+
+// Reject an announce that cannot come from the peer already holding its address (nil if none). Only a signature proves
+// an announce comes from the holder: a holder signing with a registered key only hears from that key (verified once the
+// announce passed the check), which lets it stop, change its state or restart under another peer id. Otherwise, the
+// peer id being no secret, a trusted port stays with the peer id that announced from it first until that peer times
+// out: an announce under another peer id is rejected, and one under its own may refresh it but not stop it, report
+// more left than before or drop reliable, so no one else can take over, demote or stop a live baseline provider. And
+// the transfer counters of a peer only grow, so an older announce of the same peer replayed later is stale.
+// Must be called with the tracker lock held.
+func (tr *Tracker) check(holder *Peer, p *Peer, event string) error {
+	if holder == nil {
+		return nil
+	}
+	if holder.ID == p.ID && (p.Uploaded < holder.Uploaded || p.Downloaded < holder.Downloaded) {
+		return fmt.Errorf("stale announce: uploaded %d and downloaded %d, after %d and %d", p.Uploaded, p.Downloaded, holder.Uploaded, holder.Downloaded)
+	}
+	if name, ok := tr.Registry.Trusted(holder.Key); ok {
+		if !bytes.Equal(p.Key, holder.Key) {
+			return fmt.Errorf("address %s is held by %q, the announce is not signed with its key", peerKey(p.IP, p.Port), name)
+		}
+		return nil
+	}
+	if !tr.trustedPorts[p.Port] {
+		return nil
+	}
+	if holder.ID != p.ID {
+		return fmt.Errorf("trusted port %d is held by another peer", p.Port)
+	}
+	if event == "stopped" || p.Left > holder.Left || holder.Reliable && !p.Reliable {
+		return fmt.Errorf("announce cannot stop or demote the holder of trusted port %d", p.Port)
+	}
+	return nil
+}
+
+// Drop peers that have not announced within the peer timeout.
+// Must be called with the tracker lock held.
+func (tr *Tracker) expire(s *swarm) {
+	if tr.config.PeerTimeout == 0 {
+		return
+	}
+	for k, p := range s.peers {
+		if time.Since(p.LastAnnounce) > tr.config.PeerTimeout {
+			delete(s.peers, k)
+		}
+	}
+}
+
+// Keep the promoted baseline provider if it still qualifies, otherwise promote another qualifying peer (if any).
+// A peer qualifies if it announces as reliable, signed with a registered key or (unless an identity is required) from a
+// trusted port, and has the complete file.
+// Must be called with the tracker lock held.
+func (tr *Tracker) promote(s *swarm) {
+	qualifies := func(p *Peer) bool {
+		if !p.Reliable || p.Left != 0 {
+			return false
+		}
+		if _, ok := tr.Registry.Trusted(p.Key); ok {
+			return true
+		}
+		return !tr.config.RequireIdentity && tr.trustedPorts[p.Port]
+	}
+	if bp := s.baselineProvider; bp != nil && s.peers[peerKey(bp.IP, bp.Port)] == bp && qualifies(bp) {
+		return
+	}
+	s.baselineProvider = nil
+	for _, p := range s.peers {
+		if !qualifies(p) {
+			continue
+		}
+		// Prefer the lowest port among candidates, so promotion is deterministic
+		if s.baselineProvider == nil || p.Port < s.baselineProvider.Port {
+			s.baselineProvider = p
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	rbt "github.com/anacrolix/torrent"
 
@@ -46,12 +48,16 @@ func CreateFilesInDirs(t *testing.T, dirs []string, name string, size int64) {
 
 // Create a file within each directory with specified size, return the metaInfo to be added to any client.
 func CreateMetaInfo(t *testing.T, dir string, name string, trackers [][]string) (metaInfo metainfo.MetaInfo) {
-	filePath := filepath.Join(dir, name)
+	return CreatePieceLengthMetaInfo(t, filepath.Join(dir, name), PieceLength, trackers)
+}
 
+// Create the metaInfo of the file or directory tree at the given path with the given piece length,
+// to be added to any client.
+func CreatePieceLengthMetaInfo(t *testing.T, path string, pieceLength int64, trackers [][]string) (metaInfo metainfo.MetaInfo) {
 	metaInfo = metainfo.MetaInfo{AnnounceList: trackers}
 	metaInfo.SetDefaults()
-	info := metainfo.Info{PieceLength: PieceLength}
-	err := info.BuildFromFilePath(filePath)
+	info := metainfo.Info{PieceLength: pieceLength}
+	err := info.BuildFromFilePath(path)
 	require.NoError(t, err)
 	metaInfo.InfoBytes, err = bencode.Marshal(info)
 	require.NoError(t, err)
@@ -93,3 +99,103 @@ func VerifyBaselineProvider(t *testing.T, trs []*rbt.Torrent, ports []int) {
 	}
 	fmt.Println("SUCCESS: Baseline provider matches expectation from each torrent instance")
 }
+
+// Verify that each peer of the swarm takes one of the given baseline providers for its baseline provider, as known by
+// the address the tracker hands out to it (see Swarm.Addr), or has none if none is given.
+func VerifySwarmBaselineProvider(t *testing.T, s *Swarm, peers []*Peer, bps []*Peer) {
+	fmt.Println("Verifying baseline provider against expectation for each peer")
+	for _, p := range peers {
+		bpIP, bpPort := p.Torrent.GetBaselineProvider()
+		if len(bps) == 0 {
+			require.Nil(t, bpIP, "%s has a baseline provider", p)
+			require.Zero(t, bpPort, "%s has a baseline provider", p)
+			continue
+		}
+		found := false
+		for _, bp := range bps {
+			found = found || s.TakesForBaselineProvider(p, bp)
+		}
+		require.True(t, found, "%s takes %s:%d for its baseline provider, expected one of %v", p, bpIP, bpPort, bps)
+	}
+	fmt.Println("SUCCESS: Baseline provider matches expectation from each peer")
+}
+
+// Keep checking in the background that each torrent instance has either no baseline provider yet, or one of the
+// expected ones (which it then keeps knowing about), until the returned function is called.
+// Calling it fails the test if any check did not hold.
+func WatchBaselineProvider(t *testing.T, trs []*rbt.Torrent, ports []int) (stop func()) {
+	return watchBaselineProvider(t, trs, func(i int, ip net.IP, port int) bool {
+		if !ip.Equal(net.ParseIP(Localhost)) {
+			return false
+		}
+		for _, expected := range ports {
+			if port == expected {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Like WatchBaselineProvider, for peers of the swarm expected to take one of the given baseline providers for theirs
+// (see VerifySwarmBaselineProvider).
+func WatchSwarmBaselineProvider(t *testing.T, s *Swarm, peers []*Peer, bps []*Peer) (stop func()) {
+	var trs []*rbt.Torrent
+	for _, p := range peers {
+		trs = append(trs, p.Torrent)
+	}
+	return watchBaselineProvider(t, trs, func(i int, ip net.IP, port int) bool {
+		for _, bp := range bps {
+			bpIP, bpPort := s.Addr(peers[i], bp)
+			if ip.Equal(bpIP) && port == bpPort {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Keep checking in the background that each torrent instance has either no baseline provider yet, or one for which
+// expected holds (given the index of the instance), until the returned function is called.
+func watchBaselineProvider(t *testing.T, trs []*rbt.Torrent, expected func(i int, ip net.IP, port int) bool) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	// Only the first violation of each torrent instance is kept
+	violations := make(map[int]string)
+	violate := func(i int, violation string) {
+		if _, ok := violations[i]; !ok {
+			violations[i] = violation
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		known := make(map[*rbt.Torrent]bool)
+		for {
+			for i, tr := range trs {
+				bpIP, bpPort := tr.GetBaselineProvider()
+				if bpIP == nil {
+					if known[tr] {
+						violate(i, "forgot its baseline provider")
+					}
+					continue
+				}
+				known[tr] = true
+				if !expected(i, bpIP, bpPort) {
+					violate(i, fmt.Sprintf("got baseline provider %s:%d", bpIP, bpPort))
+				}
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+		require.Empty(t, violations)
+		fmt.Println("SUCCESS: Baseline provider stayed consistent for each torrent instance")
+	}
+}
@@ -0,0 +1,90 @@
+//go:build unix
+
+package utils
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+const (
+	// File descriptors a peer holds besides its peer connections: listeners and the connections to the tracker
+	// (counting the tracker's end, as it runs in the same process).
+	peerBaseFiles = 8
+	// File descriptors kept aside for the test itself.
+	reservedFiles = 64
+	// Connections per torrent a peer keeps at most under a budget, as many leechers each connecting to every other
+	// one only adds load without speeding up the transfer.
+	maxBudgetConns = 30
+	// Fewest connections per torrent a peer can keep and still get the file from the seeder or baseline provider
+	// along with a few other leechers.
+	minBudgetConns = 4
+	// Memory the pieces being downloaded (and not verified yet) by all peers may take at once, as a virtual storage
+	// keeps them in memory.
+	budgetMemory = 1 << 30
+	// Fewest bytes a peer may download ahead of verifying them, a few pieces of the default length.
+	minBudgetUnverified = 4 * PieceLength
+)
+
+// Resources the peers of a large swarm are held to, so they all fit within the limits of the test process.
+type Budget struct {
+	// File descriptor limit of the process, once raised as far as allowed
+	FileLimit uint64
+	// Connections (established and half-open) each peer may keep per torrent
+	ConnsPerPeer int
+	// Bytes each peer may download ahead of verifying them
+	UnverifiedPerPeer int64
+}
+
+// Raise the file descriptor limit of the process as far as allowed until the test finishes, and work out how many
+// connections each of n peers may keep so they all fit within it, and how much data each may download ahead of
+// verifying it. Skips the test if the limit does not allow even a few connections per peer.
+func BudgetSwarm(t *testing.T, n int) (b Budget) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Fatalf("getting the file descriptor limit: %v", err)
+	}
+	if limit.Cur < limit.Max {
+		previous := limit
+		limit.Cur = limit.Max
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+			limit = previous
+		} else {
+			t.Cleanup(func() {
+				if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &previous); err != nil {
+					t.Errorf("restoring the file descriptor limit: %v", err)
+				}
+			})
+		}
+	}
+	b.FileLimit = limit.Cur
+
+	// Each connection takes a file descriptor on both of its ends
+	available := int64(b.FileLimit) - reservedFiles - int64(n*peerBaseFiles)
+	b.ConnsPerPeer = int(available / int64(n))
+	if b.ConnsPerPeer > maxBudgetConns {
+		b.ConnsPerPeer = maxBudgetConns
+	}
+	if b.ConnsPerPeer < minBudgetConns {
+		t.Skipf("a file descriptor limit of %d is too low for %d peers, raise it with `ulimit -n`", b.FileLimit, n)
+	}
+	b.UnverifiedPerPeer = budgetMemory / int64(n)
+	if b.UnverifiedPerPeer < minBudgetUnverified {
+		b.UnverifiedPerPeer = minBudgetUnverified
+	}
+	fmt.Printf("Budget for %d peers: %d file descriptors, %d connections and %d unverified bytes per peer\n",
+		n, b.FileLimit, b.ConnsPerPeer, b.UnverifiedPerPeer)
+	return
+}
+
+// Hold the peer to the budget, to be called from SwarmConfig.Configure. uTP is disabled, as every socket counts.
+func (b Budget) Configure(p *Peer) {
+	p.Config.EstablishedConnsPerTorrent = b.ConnsPerPeer
+	p.Config.HalfOpenConnsPerTorrent = b.ConnsPerPeer / 2
+	p.Config.TotalHalfOpenConns = b.ConnsPerPeer
+	p.Config.DisableUTP = true
+	if p.Config.MaxUnverifiedBytes > b.UnverifiedPerPeer {
+		p.Config.MaxUnverifiedBytes = b.UnverifiedPerPeer
+	}
+}
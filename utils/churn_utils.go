@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// A distribution of durations, sampled with the random source of a churn run.
+type Distribution interface {
+	Sample(r *rand.Rand) time.Duration
+	// Check that the parameters are sound and the samples are not all zero, as arrivals would never advance.
+	Validate() error
+}
+
+// Always the same duration.
+type Constant time.Duration
+
+func (c Constant) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(c)
+}
+
+func (c Constant) Validate() error {
+	if c <= 0 {
+		return fmt.Errorf("non-positive constant %v", time.Duration(c))
+	}
+	return nil
+}
+
+// Exponentially distributed durations with the given mean: as the time between two arrivals of a Poisson process,
+// or memoryless session lengths.
+type Exponential struct {
+	Mean time.Duration
+}
+
+func (e Exponential) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() * float64(e.Mean))
+}
+
+func (e Exponential) Validate() error {
+	if e.Mean <= 0 {
+		return fmt.Errorf("non-positive mean %v", e.Mean)
+	}
+	return nil
+}
+
+// Durations uniformly distributed between Min and Max.
+type Uniform struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+func (u Uniform) Sample(r *rand.Rand) time.Duration {
+	return u.Min + time.Duration(r.Int63n(int64(u.Max-u.Min)+1))
+}
+
+func (u Uniform) Validate() error {
+	switch {
+	case u.Min < 0:
+		return fmt.Errorf("negative min %v", u.Min)
+	case u.Max < u.Min:
+		return fmt.Errorf("max %v below min %v", u.Max, u.Min)
+	case u.Max == 0:
+		return errors.New("max of zero")
+	}
+	return nil
+}
+
+// A group of leechers arriving all at once.
+type FlashCrowd struct {
+	// Time since the start of the churn
+	At       time.Duration
+	Leechers int
+}
+
+// How peers arrive into and depart from a swarm over time, see RunChurn.
+type ChurnConfig struct {
+	// How long peers keep arriving.
+	Duration time.Duration
+	// Time between two leecher arrivals (Exponential for Poisson arrivals), no leecher arrives on its own if nil.
+	LeecherArrivals Distribution
+	// How long a leecher stays from its arrival (seeding once complete), until the end of the churn if nil.
+	LeecherSessions Distribution
+	// Time between two seeder arrivals, no seeder arrives if nil.
+	SeederArrivals Distribution
+	// How long a seeder stays from its arrival, until the end of the churn if nil.
+	SeederSessions Distribution
+	// Leechers arriving all at once on top of the others.
+	FlashCrowds []FlashCrowd
+	// How long to wait after Duration for the leechers still there to complete.
+	Drain time.Duration
+	// Crash departing peers (see Swarm.Crash) rather than closing them, which requires a proxied swarm.
+	Crash bool
+}
+
+// What happened to the peers of a churn run.
+type ChurnStats struct {
+	LeechersArrived   int
+	LeechersCompleted int
+	// Leechers that departed before completing
+	LeechersAbandoned int
+	SeedersArrived    int
+	SeedersDeparted   int
+	// Most leechers in the swarm at once
+	PeakLeechers int
+	// Time from arrival to completion of every leecher that completed, in the order they completed
+	CompletionTimes []time.Duration
+	// Useful bytes received by the leechers of the churn, in total and from baseline providers
+	BytesReceived              int64
+	BytesFromBaselineProviders int64
+}
+
+// Fraction of the data received by the leechers of the churn that baseline providers supplied.
+func (c ChurnStats) BaselineProviderLoad() float64 {
+	if c.BytesReceived == 0 {
+		return 0
+	}
+	return float64(c.BytesFromBaselineProviders) / float64(c.BytesReceived)
+}
+
+// Log a summary of the churn.
+func (c ChurnStats) Log(t *testing.T) {
+	t.Logf("Churn: %d leechers arrived (peak %d at once), %d completed, %d abandoned; %d seeders arrived, %d departed",
+		c.LeechersArrived, c.PeakLeechers, c.LeechersCompleted, c.LeechersAbandoned, c.SeedersArrived, c.SeedersDeparted)
+	t.Logf("Churn: baseline providers supplied %d of the %d bytes received (%.1f%%)",
+		c.BytesFromBaselineProviders, c.BytesReceived, 100*c.BaselineProviderLoad())
+}
+
+// An arrival or departure of a churn run.
+type churnEvent struct {
+	at   time.Duration
+	role Role
+	// The departing peer, nil for an arrival
+	peer *Peer
+}
+
+// A peer brought in by a churn run.
+type churnPeer struct {
+	arrived   time.Duration
+	completed bool
+	departed  bool
+}
+
+// Run churn against the swarm: start and stop peers over time as declared by the config, with every random draw
+// seeded by the test seed (see TestSeed). Returns once the churn is over and the leechers still there completed,
+// or the drain time ran out. Peers still there are left running, to be closed when the test finishes.
+func RunChurn(s *Swarm, config ChurnConfig) (stats ChurnStats) {
+	for name, d := range map[string]Distribution{
+		"leecher arrivals": config.LeecherArrivals,
+		"leecher sessions": config.LeecherSessions,
+		"seeder arrivals":  config.SeederArrivals,
+		"seeder sessions":  config.SeederSessions,
+	} {
+		if d != nil {
+			require.NoError(s.t, d.Validate(), "churn %s", name)
+		}
+	}
+	r := rand.New(rand.NewSource(TestSeed(s.t)))
+
+	// Arrivals are all drawn upfront, departures once their peer arrives
+	var events []churnEvent
+	arrivals := func(role Role, d Distribution) {
+		if d == nil {
+			return
+		}
+		for at := d.Sample(r); at < config.Duration; at += d.Sample(r) {
+			events = append(events, churnEvent{at: at, role: role})
+		}
+	}
+	arrivals(Leecher, config.LeecherArrivals)
+	arrivals(Seeder, config.SeederArrivals)
+	for _, crowd := range config.FlashCrowds {
+		for i := 0; i < crowd.Leechers; i++ {
+			events = append(events, churnEvent{at: crowd.At, role: Leecher})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].at < events[j].at })
+
+	peers := make(map[*Peer]*churnPeer)
+	numLeechers := func() (n int) {
+		for p, cp := range peers {
+			if p.Role == Leecher && !cp.departed {
+				n++
+			}
+		}
+		return
+	}
+	done := func(elapsed time.Duration) bool {
+		if elapsed < config.Duration {
+			return false
+		}
+		for _, e := range events {
+			if e.peer == nil {
+				return false
+			}
+		}
+		if elapsed >= config.Duration+config.Drain {
+			return true
+		}
+		for p, cp := range peers {
+			if p.Role == Leecher && !cp.departed && !cp.completed {
+				return false
+			}
+		}
+		return true
+	}
+
+	start := time.Now()
+	for elapsed := time.Duration(0); !done(elapsed); elapsed = time.Since(start) {
+		// Play every event that is due
+		for len(events) != 0 && events[0].at <= elapsed {
+			e := events[0]
+			events = events[1:]
+			if e.peer != nil {
+				fmt.Printf("[%v] churn: %s departing\n", elapsed.Round(time.Millisecond), e.peer)
+				s.depart(e.peer, config.Crash)
+				peers[e.peer].departed = true
+				if e.role == Seeder {
+					stats.SeedersDeparted++
+				} else if !peers[e.peer].completed {
+					stats.LeechersAbandoned++
+				}
+				continue
+			}
+			fmt.Printf("[%v] churn: %s arriving\n", elapsed.Round(time.Millisecond), e.role)
+			p := s.AddPeer(e.role, 0)
+			peers[p] = &churnPeer{arrived: elapsed}
+			sessions := config.SeederSessions
+			if e.role == Leecher {
+				p.Torrent.DownloadAll()
+				stats.LeechersArrived++
+				sessions = config.LeecherSessions
+			} else {
+				stats.SeedersArrived++
+			}
+			if sessions != nil {
+				departure := churnEvent{at: elapsed + sessions.Sample(r), role: e.role, peer: p}
+				i := sort.Search(len(events), func(i int) bool { return events[i].at > departure.at })
+				events = append(events[:i], append([]churnEvent{departure}, events[i:]...)...)
+			}
+		}
+		if n := numLeechers(); n > stats.PeakLeechers {
+			stats.PeakLeechers = n
+		}
+
+		// Check for leechers that completed
+		for p, cp := range peers {
+			if p.Role == Leecher && !cp.departed && !cp.completed && p.Torrent.BytesCompleted() == p.Torrent.Length() {
+				cp.completed = true
+				stats.LeechersCompleted++
+				stats.CompletionTimes = append(stats.CompletionTimes, time.Since(start)-cp.arrived)
+			}
+		}
+		time.Sleep(DefaultSampleInterval)
+	}
+
+	var baselineProviders []string
+	for _, p := range s.Peers(BaselineProvider) {
+		baselineProviders = append(baselineProviders, p.String())
+	}
+	for p := range peers {
+		if p.Role == Leecher {
+			fromBaselineProviders, total := s.Ledger.BytesFrom(p.String(), baselineProviders, time.Time{})
+			stats.BytesFromBaselineProviders += fromBaselineProviders
+			stats.BytesReceived += total
+		}
+	}
+	return
+}
+
+// Take a peer out of the swarm, crashing it if asked to.
+func (s *Swarm) depart(p *Peer, crash bool) {
+	if crash {
+		s.Crash(p)
+	} else {
+		p.Close()
+	}
+}
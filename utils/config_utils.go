@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	rbt "github.com/anacrolix/torrent"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// Environment variable setting the directory the data of each test is kept under, the system temp dir if unset.
+	DataRootEnv = "RBT_DATA_ROOT"
+	// Environment variable keeping the data directory of a failed test for debugging, when set to true (e.g. 1).
+	KeepDataEnv = "RBT_KEEP_DATA"
+)
+
+// The data directory of each running test, so all its peers share it.
+var testDataDirs sync.Map
+
+// Characters not allowed in the name of a data directory, as test names hold slashes (for subtests) and spaces.
+var unsafeDirChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// Return the directory the peers of the test keep their data in, created on first use and named after the test.
+// It is removed once the test finishes, unless the test failed and KeepDataEnv is set, in which case its path is logged.
+func TestDataDir(t *testing.T) string {
+	if dir, ok := testDataDirs.Load(t.Name()); ok {
+		return dir.(string)
+	}
+	root := os.Getenv(DataRootEnv)
+	if root != "" {
+		require.NoError(t, os.MkdirAll(root, 0755))
+	}
+	dir, err := os.MkdirTemp(root, unsafeDirChars.ReplaceAllString(t.Name(), "_")+"-*")
+	require.NoError(t, err)
+	if actual, loaded := testDataDirs.LoadOrStore(t.Name(), dir); loaded {
+		os.RemoveAll(dir)
+		return actual.(string)
+	}
+	// Registered before any client is created, so it runs after every client is closed
+	t.Cleanup(func() {
+		testDataDirs.Delete(t.Name())
+		if keep, _ := strconv.ParseBool(os.Getenv(KeepDataEnv)); keep && t.Failed() {
+			t.Logf("Keeping the data of the failed test in %s", dir)
+			return
+		}
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+// The data directory of the id-th peer with the given role (e.g. "seeder") within the data directory of the test.
+func PeerDataDir(t *testing.T, role string, id int) string {
+	return filepath.Join(TestDataDir(t), fmt.Sprintf("%s%d", role, id))
+}
+
+// Create the configuration of a peer with the given role, keeping its data in the given directory.
+func PeerConfig(role Role, dataDir string, listenPort int) (config *rbt.ClientConfig) {
+	config = rbt.NewDefaultClientConfig()
+	config.Seed = role != Leecher
+	config.DataDir = dataDir
+	config.NoUpload = false
+	config.NoDHT = true
+	config.DisableTCP = false
+	config.ListenPort = listenPort
+	config.Reliable = role == BaselineProvider
+	return
+}
+
+// Create the configuration for a seeder.
+func SeederConfig(t *testing.T, id int, listenPort int) (config *rbt.ClientConfig) {
+	return PeerConfig(Seeder, PeerDataDir(t, "seeder", id), listenPort)
+}
+
+// Create the configuration for a baseline provider.
+func BaselineProviderConfig(t *testing.T, id int, listenPort int) (config *rbt.ClientConfig) {
+	return PeerConfig(BaselineProvider, PeerDataDir(t, "baselineProvider", id), listenPort)
+}
+
+// Create the configuration for a leecher
+func LeecherConfig(t *testing.T, id int, listenPort int) (config *rbt.ClientConfig) {
+	return PeerConfig(Leecher, PeerDataDir(t, "leecher", id), listenPort)
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// Environment variable overriding the seed of the generated test content, to reproduce a failing run.
+	SeedEnv = "RBT_SEED"
+	// Size of the blocks content is generated by, each from its own source so any offset can be generated on its own.
+	contentBlockSize = 1 << 16
+)
+
+// The seed used by each test, so every file a test creates shares it.
+var testSeeds sync.Map
+
+// Return the content seed of the test: the one set by SeedEnv if any, otherwise a new one.
+// The seed is logged the first time, so the run can be reproduced byte-for-byte.
+func TestSeed(t *testing.T) int64 {
+	if seed, ok := testSeeds.Load(t.Name()); ok {
+		return seed.(int64)
+	}
+	seed := time.Now().UnixNano()
+	if env := os.Getenv(SeedEnv); env != "" {
+		var err error
+		seed, err = strconv.ParseInt(env, 10, 64)
+		require.NoError(t, err, "invalid %s", SeedEnv)
+	}
+	if actual, loaded := testSeeds.LoadOrStore(t.Name(), seed); loaded {
+		return actual.(int64)
+	}
+	t.Cleanup(func() { testSeeds.Delete(t.Name()) })
+	t.Logf("Using content seed %d, set %s=%d to reproduce", seed, SeedEnv, seed)
+	return seed
+}
+
+// Pseudo-random content of a given size, entirely determined by its seed: any part of it can be generated
+// (or checked) without generating what comes before.
+type Content struct {
+	Seed int64
+	Size int64
+}
+
+// Read the content at the given offset, as io.ReaderAt.
+func (c Content) ReadAt(p []byte, off int64) (n int, err error) {
+	if off >= c.Size {
+		return 0, io.EOF
+	}
+	if remaining := c.Size - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+		err = io.EOF
+	}
+	var block []byte
+	for n < len(p) {
+		index, blockOff := (off+int64(n))/contentBlockSize, (off+int64(n))%contentBlockSize
+		// Generate whole blocks in place, only partial ones need a buffer
+		if blockOff == 0 && len(p)-n >= contentBlockSize {
+			c.block(index, p[n:n+contentBlockSize])
+			n += contentBlockSize
+			continue
+		}
+		if block == nil {
+			block = make([]byte, contentBlockSize)
+		}
+		c.block(index, block)
+		n += copy(p[n:], block[blockOff:])
+	}
+	return
+}
+
+// A reader of the whole content, from its start.
+func (c Content) Reader() io.Reader {
+	return io.NewSectionReader(c, 0, c.Size)
+}
+
+// Generate a block of the content (in full, even past its size).
+func (c Content) block(index int64, buf []byte) {
+	// Mix the block index into the seed, so neighbouring blocks do not share a source
+	seed := uint64(c.Seed) ^ (uint64(index)+1)*0x9e3779b97f4a7c15
+	rand.New(rand.NewSource(int64(seed))).Read(buf)
+}
+
+// The content of a test file of the given size, seeded by the seed of the test.
+func TestContent(t *testing.T, size int64) Content {
+	return Content{Seed: TestSeed(t), Size: size}
+}
+
+// Check that the file at the given path holds exactly the content, regenerated from its seed alone.
+// Fails with the first mismatching offset if it does not.
+func VerifyContent(t *testing.T, path string, content Content) {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	require.NoError(t, err)
+	require.Equal(t, content.Size, info.Size(), "size of %s", path)
+
+	want, got := make([]byte, bufSize), make([]byte, bufSize)
+	for off := int64(0); off < content.Size; off += bufSize {
+		n, _ := content.ReadAt(want, off)
+		_, err := io.ReadFull(file, got[:n])
+		require.NoError(t, err, "reading %s at offset %d", path, off)
+		if !bytes.Equal(want[:n], got[:n]) {
+			require.FailNow(t, "content mismatch", "%s differs from the content of seed %d at offset %d",
+				path, content.Seed, off+int64(firstDifference(want[:n], got[:n])))
+		}
+	}
+}
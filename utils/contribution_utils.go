@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Useful bytes the named peer received since the given time (from the start if zero): from any of the given senders,
+// and in total.
+func (l *Ledger) BytesFrom(to string, from []string, since time.Time) (fromBytes int64, total int64) {
+	senders := make(map[string]bool)
+	for _, name := range from {
+		senders[name] = true
+	}
+	for _, r := range l.Receipts(to) {
+		if r.Time.Before(since) {
+			continue
+		}
+		total += r.Bytes
+		if senders[r.From] {
+			fromBytes += r.Bytes
+		}
+	}
+	return
+}
+
+// Which senders each piece received by the named peer came from, along with the bytes each of them sent.
+func (l *Ledger) PieceSources(to string) map[int]map[string]int64 {
+	sources := make(map[int]map[string]int64)
+	for _, r := range l.Receipts(to) {
+		if sources[r.Piece] == nil {
+			sources[r.Piece] = make(map[string]int64)
+		}
+		sources[r.Piece][r.From] += r.Bytes
+	}
+	return sources
+}
+
+// Fraction of the useful data the named peer received since the given time that came from any of the given senders,
+// zero if it received nothing.
+func (l *Ledger) ContributionFraction(to string, from []string, since time.Time) float64 {
+	fromBytes, total := l.BytesFrom(to, from, since)
+	if total == 0 {
+		return 0
+	}
+	return float64(fromBytes) / float64(total)
+}
+
+// Verify that at least the given fraction of the useful data the named peer received since the given time
+// (from the start if zero) came from any of the given senders, e.g. the baseline provider after the seeder died.
+func VerifyContribution(t *testing.T, l *Ledger, to string, from []string, since time.Time, minFraction float64) {
+	fmt.Printf("Verifying contribution of %v to %s\n", from, to)
+	fromBytes, total := l.BytesFrom(to, from, since)
+	require.NotZero(t, total, "%s received nothing", to)
+	fraction := float64(fromBytes) / float64(total)
+	require.GreaterOrEqual(t, fraction, minFraction, "%v supplied %d of the %d bytes received by %s (%.1f%%), expected at least %.1f%%",
+		from, fromBytes, total, to, 100*fraction, 100*minFraction)
+	fmt.Printf("SUCCESS: %v supplied %.1f%% of the data received by %s\n", from, 100*fraction, to)
+}
+
+// Verify that every useful byte the named peer received is attributed to a known sender, and that they add up to
+// the bytes it completed (for a peer starting empty, without any piece failing its hash check), so contributions
+// can be trusted.
+func VerifyAttribution(t *testing.T, l *Ledger, to string, completed int64) {
+	var attributed int64
+	for from, bytes := range l.BytesBySender(to) {
+		require.NotEqual(t, UnknownSender, from, "%s received %d bytes from an unknown peer", to, bytes)
+		attributed += bytes
+	}
+	require.Equal(t, completed, attributed, "bytes received by %s do not add up", to)
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// A storage wrapping another one, which corrupts a share of the chunks read from it: a peer using it believes its data
+// is fine (its own hash checks see the data as stored) but serves corrupted chunks to everyone else.
+// Which chunks are corrupted is drawn from the seed, so a chunk served twice is corrupted the same way.
+type CorruptingStorage struct {
+	inner storage.ClientImpl
+	// Share of the chunks corrupted, from 0 (none) to 1 (all of them)
+	rate float64
+	seed int64
+	// Number of chunk reads served corrupted
+	corrupted atomic.Int64
+}
+
+// A piece of a torrent opened from a corrupting storage.
+type corruptingPiece struct {
+	storage.PieceImpl
+	s     *CorruptingStorage
+	piece metainfo.Piece
+}
+
+// Wrap the storage so the given share of the chunks read from it are corrupted.
+func NewCorruptingStorage(inner storage.ClientImpl, rate float64, seed int64) *CorruptingStorage {
+	return &CorruptingStorage{inner: inner, rate: rate, seed: seed}
+}
+
+func (s *CorruptingStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	t, err := s.inner.OpenTorrent(info, infoHash)
+	if err != nil {
+		return t, err
+	}
+	piece := t.Piece
+	t.Piece = func(p metainfo.Piece) storage.PieceImpl { return corruptingPiece{PieceImpl: piece(p), s: s, piece: p} }
+	return t, nil
+}
+
+// Close the wrapped storage, if it needs closing.
+func (s *CorruptingStorage) Close() error {
+	if closer, ok := s.inner.(storage.ClientImplCloser); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Number of chunk reads served corrupted so far.
+func (s *CorruptingStorage) Corrupted() int64 {
+	return s.corrupted.Load()
+}
+
+// Whether the chunk at the given index within the torrent gets corrupted.
+func (s *CorruptingStorage) corrupts(chunk int64) bool {
+	// splitmix64 of the seed and chunk, so every chunk is drawn on its own
+	x := uint64(s.seed) + uint64(chunk+1)*0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11)/(1<<53) < s.rate
+}
+
+// Read the piece as stored, then flip every bit of the chunks drawn for corruption.
+func (p corruptingPiece) ReadAt(b []byte, off int64) (n int, err error) {
+	n, err = p.PieceImpl.ReadAt(b, off)
+	for i := 0; i < n; {
+		at := p.piece.Offset() + off + int64(i)
+		end := i + int(DefaultChunkSize-at%DefaultChunkSize)
+		if end > n {
+			end = n
+		}
+		if p.s.corrupts(at / DefaultChunkSize) {
+			for j := i; j < end; j++ {
+				b[j] ^= 0xff
+			}
+			p.s.corrupted.Add(1)
+		}
+		i = end
+	}
+	return
+}
+
+// Write the piece as stored, which is what the client hashes it through: the peer never notices its own corruption.
+func (p corruptingPiece) WriteTo(w io.Writer) (int64, error) {
+	if writerTo, ok := p.PieceImpl.(io.WriterTo); ok {
+		return writerTo.WriteTo(w)
+	}
+	return io.CopyN(w, io.NewSectionReader(p.PieceImpl, 0, p.piece.Length()), p.piece.Length())
+}
+
+// Add a peer serving corrupted data (the given share of its chunks, see CorruptingStorage) to the running swarm,
+// which must be proxied: a seeder or baseline provider corrupts what it serves from the start, a leecher once it
+// downloaded it. As peers ban each other by IP, the peer gets a loopback address of its own (see Network.AddHost),
+// skipping the test if none is available.
+func (s *Swarm) AddCorruptingPeer(role Role, rate float64) (p *Peer) {
+	require.NotNil(s.t, s.Network, "swarm is not proxied")
+	// The tracker hands out links to the peer as soon as it announces, so it needs its host before it starts
+	port := FreePort(s.t)
+	if _, err := s.Network.AddHost(port); err != nil {
+		s.t.Skipf("no loopback address for a corrupting peer: %v", err)
+	}
+	p = s.addPeer(role, port, &s.MetaInfo, func(p *Peer) {
+		inner := p.Config.DefaultStorage
+		if inner == nil {
+			inner = storage.NewFile(p.Config.DataDir)
+		}
+		p.Corrupting = NewCorruptingStorage(inner, rate, TestSeed(s.t))
+		p.Config.DefaultStorage = p.Corrupting
+		// Cleanups run last-in-first-out, so the storage is closed once the client is
+		s.t.Cleanup(func() { p.Corrupting.Close() })
+	})
+	fmt.Printf("Added %s corrupting %.0f%% of its chunks, on host %v\n", p, 100*rate, s.IP(p))
+	return
+}
+
+// The IP the other peers see the given one under: its own loopback address if it was given one, Localhost otherwise.
+func (s *Swarm) IP(p *Peer) net.IP {
+	if s.Network == nil {
+		return net.ParseIP(Localhost)
+	}
+	return s.Network.Host(p.Client.LocalPort())
+}
+
+// Check that each peer rejected at least one piece that failed its hash check, banned the IP of the corrupting peer,
+// and has no connection left to it.
+func VerifyBanned(t *testing.T, s *Swarm, corrupting *Peer, peers []*Peer) {
+	fmt.Println("Verifying that the corrupting peer is rejected and banned")
+	ip := s.IP(corrupting)
+	for _, p := range peers {
+		stats := p.Torrent.Stats()
+		require.NotZero(t, stats.PiecesDirtiedBad.Int64(), "%s rejected no piece", p)
+		require.Contains(t, p.Client.BadPeerIPs(), ip.String(), "%s did not ban %s", p, corrupting)
+		require.Eventually(t, func() bool {
+			return s.Link(p, corrupting).NumConns()+s.Link(corrupting, p).NumConns() == 0
+		}, 5*time.Second, 100*time.Millisecond, "%s still connected to %s", p, corrupting)
+	}
+	fmt.Println("SUCCESS: Corrupting peer rejected and banned")
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The baseline provider the tracker currently promotes for the swarm's torrent, nil if none or if it is no peer of the
+// swarm.
+func (s *Swarm) PromotedBaselineProvider() *Peer {
+	promoted, ok := s.Tracker.BaselineProvider(s.MetaInfo.HashInfoBytes())
+	if !ok {
+		return nil
+	}
+	for _, p := range s.peers[BaselineProvider] {
+		if p.Client.LocalPort() == promoted.Port {
+			return p
+		}
+	}
+	return nil
+}
+
+// Wait until the tracker promotes another baseline provider in place of the given one, which died, and until each of
+// the given peers takes the new one for its baseline provider, both within the given bound from now.
+// Returns the new baseline provider.
+func (s *Swarm) WaitFailover(dead *Peer, peers []*Peer, within time.Duration) (bp *Peer) {
+	fmt.Printf("Waiting for the tracker and %d peers to fail over from %s\n", len(peers), dead)
+	start := time.Now()
+	require.Eventually(s.t, func() bool {
+		bp = s.PromotedBaselineProvider()
+		return bp != nil && bp != dead
+	}, within, within/100, "tracker did not promote another baseline provider than %s", dead)
+	fmt.Printf("Tracker promoted %s after %v\n", bp, time.Since(start).Round(time.Millisecond))
+
+	for _, p := range peers {
+		require.Eventually(s.t, func() bool {
+			return s.TakesForBaselineProvider(p, bp)
+		}, time.Until(start.Add(within)), within/100, "%s did not switch to %s", p, bp)
+		fmt.Printf("%s switched to %s after %v\n", p, bp, time.Since(start).Round(time.Millisecond))
+	}
+	fmt.Printf("SUCCESS: Failed over from %s to %s within %v\n", dead, bp, within)
+	return
+}
@@ -2,13 +2,16 @@ package utils
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/anacrolix/torrent/metainfo"
 	"github.com/stretchr/testify/require"
 )
 
@@ -23,11 +26,17 @@ func CreateDir(t *testing.T, path string) {
 	}
 }
 
-// Create a file at specified location with randomized content of specifed amount,
+// Create a file at specified location with pseudo-random content of specifed amount (seeded by the test, see TestSeed),
 // And duplicated it among all spoecified locations,
 // Returns the first one of them.
 // Fails if any file IO fails (but not when the file already exists) or no path is given.
 func CreateFiles(t *testing.T, paths []string, size int64) (file *os.File) {
+	return CreateContentFiles(t, paths, TestContent(t, size))
+}
+
+// Create a file holding the given content at each specified location, returns the first one of them.
+// Fails if any file IO fails (but not when the file already exists) or no path is given.
+func CreateContentFiles(t *testing.T, paths []string, content Content) (file *os.File) {
 	require.NotZero(t, len(paths))
 	// First ensure the directories are good
 	for _, path := range paths {
@@ -46,90 +55,173 @@ func CreateFiles(t *testing.T, paths []string, size int64) (file *os.File) {
 		files[i] = file
 	}
 
-	// Write chunks by chunks of randomized data
+	// Write chunks by chunks of seeded data
 	buf := make([]byte, bufSize)
-	for size >= bufSize {
-		_, err := rand.Read(buf)
-		if err != nil {
-			t.FailNow()
-		}
+	for off := int64(0); off < content.Size; off += bufSize {
+		n, _ := content.ReadAt(buf, off)
 		for _, file := range files {
-			_, err = file.Write(buf)
+			_, err := file.Write(buf[:n])
 			if err != nil {
 				t.FailNow()
 			}
 		}
-		size -= bufSize
 	}
+	return files[0]
+}
 
-	// Write the remaining incomplete chunk
-	if size != 0 {
-		buf = make([]byte, size)
-		_, err := rand.Read(buf)
-		if err != nil {
-			t.FailNow()
-		}
-		for _, file := range files {
-			_, err = file.Write(buf)
-			if err != nil {
-				t.FailNow()
-			}
-		}
+// Copy the file at the source path to the destination path, creating its directory if needed.
+// Fails if any file IO fails.
+func CopyFile(t *testing.T, srcPath string, dstPath string) {
+	CreateDir(t, filepath.Dir(dstPath))
+	src, err := os.Open(srcPath)
+	if err != nil {
+		t.FailNow()
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		t.FailNow()
+	}
+	defer dst.Close()
+
+	_, err = io.CopyBuffer(dst, src, make([]byte, bufSize))
+	if err != nil {
+		t.FailNow()
 	}
-	return files[0]
 }
 
 // Check whether file at each path to be checked has the same content as that at the reference path,
-// Fails if any file IO fails or any file content mismatch is found.
+// Fails if any file IO fails or any file content mismatch is found, with the offset of the first differing byte and the
+// directory it was found in. Prefer VerifyPieces, which needs no reference copy and tells the mismatching piece.
 func VerifyFileContent(t *testing.T, name string, refDir string, checkDirs []string) {
 	fmt.Println("Verifying file content equality")
 	// Open the reference file and to-be-verified ones
-	refFile, err := os.Open(filepath.Join(refDir, name))
-	if err != nil {
-		t.FailNow()
-	}
+	refPath := filepath.Join(refDir, name)
+	refFile, err := os.Open(refPath)
+	require.NoError(t, err, "opening reference file")
 	defer refFile.Close()
+	refInfo, err := refFile.Stat()
+	require.NoError(t, err)
 
 	checkFiles := make([]*os.File, len(checkDirs))
 	for i, checkDir := range checkDirs {
 		checkFiles[i], err = os.Open(filepath.Join(checkDir, name))
-		if err != nil {
-			t.FailNow()
-		}
+		require.NoError(t, err, "opening file of %s", checkDir)
 		defer checkFiles[i].Close()
+		checkInfo, err := checkFiles[i].Stat()
+		require.NoError(t, err)
+		require.Equal(t, refInfo.Size(), checkInfo.Size(), "size of the file in %s", checkDir)
 	}
 
-	for {
-		refBuf := make([]byte, bufSize)
-		refBytesRead, err := io.ReadFull(refFile, refBuf)
+	// Compare block by block, reporting the first differing byte (see VerifyPieces for the piece it falls in)
+	refBuf := make([]byte, bufSize)
+	checkBuf := make([]byte, bufSize)
+	for off := int64(0); off < refInfo.Size(); off += bufSize {
+		n, err := io.ReadFull(refFile, refBuf)
+		if err != io.ErrUnexpectedEOF {
+			require.NoError(t, err, "reading %s at offset %d", refPath, off)
+		}
+		for i, checkFile := range checkFiles {
+			_, err := io.ReadFull(checkFile, checkBuf[:n])
+			require.NoError(t, err, "reading file of %s at offset %d", checkDirs[i], off)
+			if !bytes.Equal(refBuf[:n], checkBuf[:n]) {
+				require.FailNow(t, "file content mismatch", "%s of %s differs from %s from byte offset %d",
+					name, checkDirs[i], refDir, off+int64(firstDifference(refBuf[:n], checkBuf[:n])))
+			}
+		}
+	}
+	fmt.Println("SUCCESS: File content equality holds")
+}
 
-		endOfFile := false
+// Check that the files of the torrent within each directory have the sizes its metainfo lists and match its piece
+// hashes. Fails if any file IO fails, any file has another size, or any piece does not match its hash, with the first
+// mismatching piece (its byte offset, and the file it starts in) and the directory it was found in.
+func VerifyPieces(t *testing.T, metaInfo *metainfo.MetaInfo, checkDirs []string) {
+	fmt.Println("Verifying file content against piece hashes")
+	info, err := metaInfo.UnmarshalInfo()
+	require.NoError(t, err)
+	for _, checkDir := range checkDirs {
+		verifyPiecesIn(t, &info, checkDir)
+	}
+	fmt.Println("SUCCESS: Piece hashes hold")
+}
 
-		// Error acceptable only if reaching EOF
-		if err != nil {
-			if err != io.ErrUnexpectedEOF {
-				t.FailNow()
-			}
-			endOfFile = true
+// Check the files of the torrent within the directory against the sizes and piece hashes of its info, see VerifyPieces.
+func verifyPiecesIn(t *testing.T, info *metainfo.Info, checkDir string) {
+	paths := TorrentFilePaths(checkDir, info)
+	files := make([]io.Reader, len(paths))
+	for i, fi := range info.UpvertedFiles() {
+		file, err := os.Open(paths[i])
+		require.NoError(t, err, "opening file of %s", checkDir)
+		defer file.Close()
+		stat, err := file.Stat()
+		require.NoError(t, err)
+		require.Equal(t, fi.Length, stat.Size(), "size of %s", paths[i])
+		files[i] = file
+	}
+	r := io.MultiReader(files...)
+	buf := make([]byte, info.PieceLength)
+	for i := 0; i < info.NumPieces(); i++ {
+		piece := info.Piece(i)
+		_, err := io.ReadFull(r, buf[:piece.Length()])
+		hash := sha1.Sum(buf[:piece.Length()])
+		if err != nil || !bytes.Equal(hash[:], piece.Hash().Bytes()) {
+			path, fileOff := fileAt(paths, info, piece.Offset())
+			require.FailNow(t, "piece hash mismatch", "piece %d (byte offset %d, %s at offset %d) of %s does not match its hash (read error: %v)",
+				i, piece.Offset(), path, fileOff, checkDir, err)
 		}
+	}
+}
 
-		checkBuf := make([]byte, bufSize)
-		for _, checkFile := range checkFiles {
-			checkBytesRead, err := io.ReadFull(checkFile, checkBuf)
+// Check that the file within each directory has the given SHA-256 sum,
+// Fails if any file IO fails or any sum differs, with the directory it was found in.
+func VerifySHA256(t *testing.T, name string, checkDirs []string, sum [sha256.Size]byte) {
+	fmt.Println("Verifying file SHA-256")
+	for _, checkDir := range checkDirs {
+		require.Equal(t, hex.EncodeToString(sum[:]), hex.EncodeToString(FileSHA256(t, filepath.Join(checkDir, name))),
+			"SHA-256 of %s in %s", name, checkDir)
+	}
+	fmt.Println("SUCCESS: File SHA-256 holds")
+}
 
-			// Error acceptable only if reaching EOF when reference also does so
-			if err != nil && (err != io.ErrUnexpectedEOF || !endOfFile) {
-				t.FailNow()
-			}
+// Compute the SHA-256 sum of the file at the given path.
+func FileSHA256(t *testing.T, path string) []byte {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	h := sha256.New()
+	_, err = io.CopyBuffer(h, file, make([]byte, bufSize))
+	require.NoError(t, err)
+	return h.Sum(nil)
+}
 
-			if refBytesRead != checkBytesRead || !bytes.Equal(refBuf, checkBuf) {
-				t.FailNow()
-			}
-		}
+// The paths of the files of a torrent within a directory, in the order of the torrent.
+func TorrentFilePaths(dir string, info *metainfo.Info) (paths []string) {
+	if !info.IsDir() {
+		return []string{filepath.Join(dir, info.BestName())}
+	}
+	for _, fi := range info.UpvertedFiles() {
+		paths = append(paths, filepath.Join(append([]string{dir, info.BestName()}, fi.BestPath()...)...))
+	}
+	return
+}
 
-		if endOfFile {
-			fmt.Println("SUCCESS: File content equality holds")
-			return
+// The file holding the byte at the given offset of a torrent, along with the offset within that file.
+func fileAt(paths []string, info *metainfo.Info, off int64) (string, int64) {
+	for i, fi := range info.UpvertedFiles() {
+		if off < fi.Length {
+			return paths[i], off
 		}
+		off -= fi.Length
+	}
+	return paths[len(paths)-1], off
+}
+
+// Index of the first byte differing between two buffers of the same length.
+func firstDifference(a []byte, b []byte) (i int) {
+	for i < len(a) && a[i] == b[i] {
+		i++
 	}
+	return
 }
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// Peer id prefix an impostor sends in the peer wire handshake, as a baseline provider build of the client could.
+	ImpostorPeerIDPrefix = "-RBTBP0-"
+	// Reserved handshake bit an impostor sets to claim baseline provider status, one no BEP assigns.
+	ImpostorExtensionBit pp.ExtensionBit = 47
+)
+
+// Add a peer claiming to be a baseline provider in every way a peer can on its own, without the tracker trusting it:
+// it starts with the complete file, announces as reliable (config.Reliable), and sends ImpostorPeerIDPrefix and
+// ImpostorExtensionBit in its handshakes. Joins on a free port if the given one is zero.
+func (s *Swarm) AddImpostor(listenPort int) (p *Peer) {
+	if listenPort == 0 {
+		listenPort = FreePort(s.t)
+	}
+	p = s.addPeer(Seeder, listenPort, &s.MetaInfo, func(p *Peer) {
+		p.Config.Reliable = true
+		p.Config.Bep20 = ImpostorPeerIDPrefix
+		p.Config.Extensions.SetBit(ImpostorExtensionBit, true)
+	})
+	fmt.Printf("Added %s as an impostor baseline provider on port %d\n", p, listenPort)
+	return
+}
+
+// Check that the impostor claimed baseline provider status to the tracker, yet the tracker never named it as baseline
+// provider, and none of the given peers takes it for their baseline provider.
+func VerifyNotFavored(t *testing.T, s *Swarm, impostor *Peer, peers []*Peer) {
+	fmt.Println("Verifying that the impostor is not taken for a baseline provider")
+	infoHash := s.MetaInfo.HashInfoBytes()
+	port := impostor.Client.LocalPort()
+	announcements := s.Tracker.Recorder.ByPort(infoHash)[port]
+	require.NotEmpty(t, announcements, "impostor never announced")
+	require.True(t, announcements[len(announcements)-1].Reliable, "impostor did not claim to be reliable")
+	if bp, ok := s.Tracker.BaselineProvider(infoHash); ok {
+		require.NotEqual(t, port, bp.Port, "tracker promoted the impostor")
+	}
+	for _, p := range peers {
+		require.False(t, s.TakesForBaselineProvider(p, impostor), "%s takes the impostor for its baseline provider", p)
+	}
+	fmt.Println("SUCCESS: Impostor not taken for a baseline provider")
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	rbt "github.com/anacrolix/torrent"
+)
+
+// Name given to the sender of data received from a peer that was never registered with the ledger.
+const UnknownSender = "unknown"
+
+// A chunk of useful data (i.e. not already held) received by a peer.
+type Receipt struct {
+	Time time.Time
+	// Name of the peer the chunk came from, UnknownSender if it is not registered
+	From  string
+	Piece int
+	Bytes int64
+}
+
+// Keeps track of where the data received by each peer came from, using the callbacks of the clients.
+type Ledger struct {
+	mu       sync.Mutex
+	names    map[rbt.PeerID]string
+	receipts map[string][]receipt
+}
+
+// A receipt as recorded, the sender is only resolved to a name when read.
+type receipt struct {
+	time  time.Time
+	from  rbt.PeerID
+	piece int
+	bytes int64
+}
+
+// Create an empty ledger, see Ledger.Install.
+func NewLedger() *Ledger {
+	return &Ledger{
+		names:    make(map[rbt.PeerID]string),
+		receipts: make(map[string][]receipt),
+	}
+}
+
+// Record the useful data received by the client created from the given config under the given name.
+// Must be called before the client is created.
+func (l *Ledger) Install(name string, config *rbt.ClientConfig) {
+	config.Callbacks.ReceivedUsefulData = append(config.Callbacks.ReceivedUsefulData, func(e rbt.ReceivedUsefulDataEvent) {
+		r := receipt{time: time.Now(), piece: int(e.Message.Index), bytes: int64(len(e.Message.Piece))}
+		if pc, ok := e.Peer.TryAsPeerConn(); ok {
+			r.from = pc.PeerID
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.receipts[name] = append(l.receipts[name], r)
+	})
+}
+
+// Let data sent by the given client be attributed to the given name.
+func (l *Ledger) Register(name string, client *rbt.Client) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.names[client.PeerID()] = name
+}
+
+// Every chunk of useful data received by the named peer, in the order they were received.
+func (l *Ledger) Receipts(to string) (receipts []Receipt) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range l.receipts[to] {
+		from, ok := l.names[r.from]
+		if !ok {
+			from = UnknownSender
+		}
+		receipts = append(receipts, Receipt{Time: r.time, From: from, Piece: r.piece, Bytes: r.bytes})
+	}
+	return
+}
+
+// Number of useful bytes the named peer received from each sender.
+func (l *Ledger) BytesBySender(to string) map[string]int64 {
+	bytes := make(map[string]int64)
+	for _, r := range l.Receipts(to) {
+		bytes[r.From] += r.Bytes
+	}
+	return bytes
+}
+
+// When the named peer received its first useful byte, false if it never did.
+func (l *Ledger) FirstReceipt(to string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.receipts[to]) == 0 {
+		return time.Time{}, false
+	}
+	return l.receipts[to][0].time, true
+}
@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"text/tabwriter"
+)
+
+// Combinations to run a scenario across: every piece length with every file size and every number of leechers.
+// A dimension left empty keeps the value of the scenario.
+type Matrix struct {
+	PieceLengths []int64
+	FileSizes    []int64
+	// Number of copies of each leecher of the scenario, see Scenario.WithLeechers
+	Leechers []int
+}
+
+// One combination of a matrix.
+type MatrixCell struct {
+	PieceLength int64
+	FileSize    int64
+	Leechers    int
+}
+
+// The outcome of running a scenario for one combination of a matrix.
+type MatrixResult struct {
+	MatrixCell
+	Scenario string
+	Passed   bool
+	// Seconds until the slowest (and fastest) leecher completed, -1 if any did not
+	SlowestCompletion float64
+	FastestCompletion float64
+}
+
+// Every combination of the matrix, in a stable order.
+func (m Matrix) Cells(scenario Scenario) (cells []MatrixCell) {
+	pieceLengths, fileSizes, leechers := m.PieceLengths, m.FileSizes, m.Leechers
+	if len(pieceLengths) == 0 {
+		pieceLengths = []int64{scenario.PieceLength}
+	}
+	if len(fileSizes) == 0 {
+		fileSizes = []int64{int64(scenario.FileSize)}
+	}
+	if len(leechers) == 0 {
+		leechers = []int{1}
+	}
+	for _, pieceLength := range pieceLengths {
+		for _, fileSize := range fileSizes {
+			for _, n := range leechers {
+				cells = append(cells, MatrixCell{PieceLength: pieceLength, FileSize: fileSize, Leechers: n})
+			}
+		}
+	}
+	return
+}
+
+func (c MatrixCell) String() string {
+	return fmt.Sprintf("pl%d_fs%d_l%d", c.PieceLength, c.FileSize, c.Leechers)
+}
+
+// Copy the scenario with n copies of each leecher (n=1 leaves it as is). The copies of a leecher named X are named
+// X_2 to X_n and listen on a free port; wherever X is named in the timeline or the expectations, its copies are too.
+func (sc Scenario) WithLeechers(n int) Scenario {
+	if n <= 1 {
+		return sc
+	}
+	copies := make(map[string][]string)
+	var peers []ScenarioPeer
+	for _, p := range sc.Peers {
+		peers = append(peers, p)
+		if p.Role != "leecher" {
+			continue
+		}
+		copies[p.Name] = []string{p.Name}
+		for i := 2; i <= n; i++ {
+			c := p
+			c.Name = fmt.Sprintf("%s_%d", p.Name, i)
+			c.Port = 0
+			peers = append(peers, c)
+			copies[p.Name] = append(copies[p.Name], c.Name)
+		}
+	}
+	expand := func(names []string) (expanded []string) {
+		for _, name := range names {
+			if c, ok := copies[name]; ok {
+				expanded = append(expanded, c...)
+			} else {
+				expanded = append(expanded, name)
+			}
+		}
+		return
+	}
+	sc.Peers = peers
+	timeline := make([]ScenarioEvent, len(sc.Timeline))
+	for i, e := range sc.Timeline {
+		e.Peers, e.To = expand(e.Peers), expand(e.To)
+		timeline[i] = e
+	}
+	sc.Timeline = timeline
+	sc.Expect.Complete = expand(sc.Expect.Complete)
+	sc.Expect.Incomplete = expand(sc.Expect.Incomplete)
+	sc.Expect.Uploaded = expand(sc.Expect.Uploaded)
+	var bps []ScenarioBaselineProviderExpectation
+	for _, bp := range sc.Expect.BaselineProvider {
+		bp.Peers, bp.BaselineProviders = expand(bp.Peers), expand(bp.BaselineProviders)
+		bps = append(bps, bp)
+	}
+	sc.Expect.BaselineProvider = bps
+	return sc
+}
+
+// Run the scenario once for every combination of the matrix, each as a subtest named after its combination, then
+// print a summary table of the outcomes and write it as <name>_matrix.csv into the results directory.
+func RunMatrix(t *testing.T, scenario Scenario, m Matrix) (results []MatrixResult) {
+	for _, cell := range m.Cells(scenario) {
+		sc := scenario.WithLeechers(cell.Leechers)
+		sc.Name = fmt.Sprintf("%s_%s", scenario.Name, cell)
+		sc.PieceLength = cell.PieceLength
+		sc.FileSize = float64(cell.FileSize)
+		result := MatrixResult{MatrixCell: cell, Scenario: sc.Name, SlowestCompletion: -1, FastestCompletion: -1}
+		t.Run(cell.String(), func(t *testing.T) {
+			runScenario(t, sc, func(r Report) {
+				result.Passed = r.Passed
+				result.SlowestCompletion, result.FastestCompletion = completionRange(r)
+			})
+		})
+		results = append(results, result)
+	}
+
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "piece length\tfile size\tleechers\tpassed\tfastest (s)\tslowest (s)")
+	for _, r := range results {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%t\t%s\t%s\n", r.PieceLength, r.FileSize, r.Leechers, r.Passed,
+			formatCompletion(r.FastestCompletion), formatCompletion(r.SlowestCompletion))
+	}
+	w.Flush()
+	fmt.Printf("Matrix of scenario %s:\n%s", scenario.Name, table.String())
+
+	if err := writeMatrix(filepath.Join(ResultsDir(), scenario.Name+"_matrix.csv"), results); err != nil {
+		t.Errorf("writing matrix of scenario %s: %v", scenario.Name, err)
+	}
+	return
+}
+
+// Seconds until the slowest and the fastest leecher of a report completed, -1 if any leecher did not.
+func completionRange(r Report) (slowest float64, fastest float64) {
+	slowest, fastest = -1, -1
+	for _, p := range r.Peers {
+		if p.Role != "leecher" {
+			continue
+		}
+		if p.TimeToComplete == nil {
+			return -1, -1
+		}
+		if slowest < 0 || *p.TimeToComplete > slowest {
+			slowest = *p.TimeToComplete
+		}
+		if fastest < 0 || *p.TimeToComplete < fastest {
+			fastest = *p.TimeToComplete
+		}
+	}
+	return
+}
+
+func formatCompletion(seconds float64) string {
+	if seconds < 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+func writeMatrix(path string, results []MatrixResult) (err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"scenario", "piece_length", "file_size", "leechers", "passed", "fastest_completion", "slowest_completion"})
+	for _, r := range results {
+		w.Write([]string{
+			r.Scenario, fmt.Sprint(r.PieceLength), fmt.Sprint(r.FileSize), fmt.Sprint(r.Leechers), strconv.FormatBool(r.Passed),
+			formatCompletion(r.FastestCompletion), formatCompletion(r.SlowestCompletion),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
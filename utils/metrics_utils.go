@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	rbt "github.com/anacrolix/torrent"
+	"github.com/stretchr/testify/require"
+)
+
+// Sampling interval of the transfer metrics when none is given.
+const DefaultSampleInterval = 100 * time.Millisecond
+
+// The state of a torrent at one point of a test.
+type Sample struct {
+	Time time.Time
+	// Time since the metrics started
+	Elapsed        time.Duration
+	BytesCompleted int64
+	Uploaded       int64
+	Downloaded     int64
+	ActivePeers    int
+	// Address of the baseline provider known to the torrent, empty if none
+	BaselineProvider string
+}
+
+// A time-series of samples of one torrent.
+type Series struct {
+	Name    string
+	Samples []Sample
+}
+
+// Samples every tracked torrent at a fixed interval, keeping the full series of each of them.
+type Metrics struct {
+	t        *testing.T
+	interval time.Duration
+	start    time.Time
+
+	mu       sync.Mutex
+	torrents map[string]*rbt.Torrent
+	series   map[string]*Series
+	order    []string
+	marks    map[string]time.Time
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Start sampling at the given interval (DefaultSampleInterval if zero) until Stop is called or the test finishes.
+// Torrents are only sampled once tracked, see Metrics.Track.
+func StartMetrics(t *testing.T, interval time.Duration) *Metrics {
+	if interval == 0 {
+		interval = DefaultSampleInterval
+	}
+	m := &Metrics{
+		t:        t,
+		interval: interval,
+		start:    time.Now(),
+		torrents: make(map[string]*rbt.Torrent),
+		series:   make(map[string]*Series),
+		marks:    make(map[string]time.Time),
+		done:     make(chan struct{}),
+	}
+	m.wg.Add(1)
+	go m.run()
+	t.Cleanup(m.Stop)
+	return m
+}
+
+// Start sampling a torrent under the given name, which it keeps until the end (even once it is closed).
+func (m *Metrics) Track(name string, tr *rbt.Torrent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.series[name]; !ok {
+		m.series[name] = &Series{Name: name}
+		m.order = append(m.order, name)
+	}
+	m.torrents[name] = tr
+	m.sample(name, time.Now())
+}
+
+// Record the current time under the given label (e.g. "seeder killed"), to measure durations from it.
+func (m *Metrics) Mark(label string) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.marks[label] = now
+	return now
+}
+
+// The time recorded under the given label, see Metrics.Mark.
+func (m *Metrics) MarkTime(label string) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	at, ok := m.marks[label]
+	return at, ok
+}
+
+// Take a last sample of every torrent and stop sampling. Later calls are ignored.
+func (m *Metrics) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.done)
+		m.wg.Wait()
+		m.sampleAll()
+	})
+}
+
+// Return a copy of the series of the torrent tracked under the given name.
+func (m *Metrics) Series(name string) Series {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[name]
+	require.True(m.t, ok, "no torrent tracked as %q", name)
+	return Series{Name: s.Name, Samples: append([]Sample(nil), s.Samples...)}
+}
+
+// Return a copy of every series, in the order their torrents were tracked.
+func (m *Metrics) AllSeries() (all []Series) {
+	m.mu.Lock()
+	names := append([]string(nil), m.order...)
+	m.mu.Unlock()
+	for _, name := range names {
+		all = append(all, m.Series(name))
+	}
+	return
+}
+
+// How long after `since` the torrent tracked under the given name first satisfied the condition,
+// false if it never did (as far as the samples show).
+func (m *Metrics) TimeUntil(name string, since time.Time, cond func(s Sample) bool) (time.Duration, bool) {
+	for _, s := range m.Series(name).Samples {
+		if !s.Time.Before(since) && cond(s) {
+			return s.Time.Sub(since), true
+		}
+	}
+	return 0, false
+}
+
+// Log the last sample of every series.
+func (m *Metrics) LogSummary() {
+	for _, s := range m.AllSeries() {
+		if len(s.Samples) == 0 {
+			continue
+		}
+		last := s.Samples[len(s.Samples)-1]
+		bp := last.BaselineProvider
+		if bp == "" {
+			bp = "none"
+		}
+		m.t.Logf("%s after %v: completed=%d uploaded=%d downloaded=%d active peers=%d baseline provider=%s",
+			s.Name, last.Elapsed.Round(time.Millisecond), last.BytesCompleted, last.Uploaded, last.Downloaded, last.ActivePeers, bp)
+	}
+}
+
+// The rate at which a value grew over the samples between two points in time, in bytes per second.
+func (s Series) Rate(from time.Time, to time.Time, value func(s Sample) int64) float64 {
+	i := sort.Search(len(s.Samples), func(i int) bool { return !s.Samples[i].Time.Before(from) })
+	j := sort.Search(len(s.Samples), func(j int) bool { return s.Samples[j].Time.After(to) }) - 1
+	if i >= len(s.Samples) || j <= i {
+		return 0
+	}
+	first, last := s.Samples[i], s.Samples[j]
+	return float64(value(last)-value(first)) / last.Time.Sub(first.Time).Seconds()
+}
+
+func (m *Metrics) run() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.sampleAll()
+		}
+	}
+}
+
+func (m *Metrics) sampleAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for name := range m.torrents {
+		m.sample(name, now)
+	}
+}
+
+// Append a sample of a torrent to its series, skipping torrents that were closed (their last values are kept).
+// Must be called with the metrics lock held.
+func (m *Metrics) sample(name string, now time.Time) {
+	tr := m.torrents[name]
+	select {
+	case <-tr.Closed():
+		return
+	default:
+	}
+	s := SampleTorrent(tr, now)
+	s.Elapsed = now.Sub(m.start)
+	m.series[name].Samples = append(m.series[name].Samples, s)
+}
+
+// Take a sample of the state of a torrent at the given time (leaving Elapsed unset).
+func SampleTorrent(tr *rbt.Torrent, now time.Time) Sample {
+	s := Sample{
+		Time:           now,
+		BytesCompleted: tr.BytesCompleted(),
+		Uploaded:       tr.UploadedBytes(),
+		Downloaded:     tr.DownloadedBytes(),
+		ActivePeers:    tr.Stats().ActivePeers,
+	}
+	if bpIP, bpPort := tr.GetBaselineProvider(); bpIP != nil {
+		s.BaselineProvider = net.JoinHostPort(bpIP.String(), fmt.Sprint(bpPort))
+	}
+	return s
+}
+
+// The p-th percentile (0 to 100) of the durations, by the nearest-rank method. Zero if there is none.
+func Percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Log the memory held by the process, e.g. after a large swarm completed.
+func LogMemory(t *testing.T) {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	t.Logf("Memory: %d MiB heap in use, %d MiB obtained from the OS, %d goroutines",
+		m.HeapInuse>>20, m.Sys>>20, runtime.NumGoroutine())
+}
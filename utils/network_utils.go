@@ -0,0 +1,440 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// Size of the chunks a link forwards at once.
+	linkChunkSize = DefaultChunkSize
+	// Delay added to a chunk hit by packet loss, as a TCP retransmission timeout would.
+	retransmissionTimeout = 200 * time.Millisecond
+)
+
+// Faults injected into a link, all of them can be changed while connections are open.
+type LinkFaults struct {
+	// Delay added to every chunk, in each direction.
+	Latency time.Duration
+	// Maximum random delay added on top of the latency (chunks are never reordered).
+	Jitter time.Duration
+	// Bytes per second forwarded in each direction, unlimited if zero.
+	Bandwidth float64
+	// Probability of a chunk being "lost", delaying it by a retransmission timeout (TCP hides the loss itself).
+	PacketLoss float64
+	// Probability of a new connection being dropped right after it is accepted.
+	ConnDropRate float64
+	// Black-hole the link: new connections are dropped and nothing is forwarded on established ones.
+	Down bool
+}
+
+// A one-way proxy from one peer to another (identified by their listen ports): the first peer dials the address of
+// the link instead of the second peer's listen port, and every byte exchanged goes through the injected faults.
+type Link struct {
+	From int
+	To   int
+
+	network  *Network
+	listener net.Listener
+	target   string
+	// Address the connections to the target are dialed from
+	dialer net.Dialer
+
+	mu      sync.Mutex
+	faults  LinkFaults
+	limiter *rate.Limiter
+	conns   map[*linkConn]struct{}
+	// When each connection over the link was opened, including the ones dropped right away
+	dials  []time.Time
+	closed bool
+}
+
+// A proxied connection along with the connection to the target peer.
+type linkConn struct {
+	src       net.Conn
+	dst       net.Conn
+	done      chan struct{}
+	resetOnce sync.Once
+}
+
+// A set of links between peers on the loopback interface, created on demand.
+type Network struct {
+	mu       sync.Mutex
+	links    map[[2]int]*Link
+	defaults LinkFaults
+	// Group of each partitioned port, ports without a group reach everyone
+	partition map[int]int
+	// Ports cut off from everyone for good, see Network.Isolate
+	isolated map[int]bool
+	// Loopback addresses of the peers given one of their own, see Network.AddHost
+	hosts  map[int]net.IP
+	closed bool
+
+	// Source of the dropped connections, jitter and packet loss of every link, shared by their goroutines
+	randomMu sync.Mutex
+	random   *rand.Rand
+}
+
+// Create a network without any link, see Network.Link. Its faults are drawn from a source seeded by the given seed,
+// so a run can be reproduced.
+func NewNetwork(seed int64) *Network {
+	return &Network{
+		links:    make(map[[2]int]*Link),
+		isolated: make(map[int]bool),
+		hosts:    make(map[int]net.IP),
+		random:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Draw a float in [0, 1) from the source of the network.
+func (n *Network) float64() float64 {
+	n.randomMu.Lock()
+	defer n.randomMu.Unlock()
+	return n.random.Float64()
+}
+
+// Draw an integer in [0, max) from the source of the network.
+func (n *Network) int63n(max int64) int64 {
+	n.randomMu.Lock()
+	defer n.randomMu.Unlock()
+	return n.random.Int63n(max)
+}
+
+// Give the peer listening on the port a loopback address of its own instead of Localhost, to be done before any link
+// from or to it is created: the links to it listen on that address, and the links from it dial the others from it.
+// Peers then see it under an IP of its own, as they would a remote host, and banning that IP leaves everyone else be.
+// Fails if the address is not available, as on macOS where 127.0.0.1 is the only loopback address by default.
+func (n *Network) AddHost(port int) (ip net.IP, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.hosts[port]; ok {
+		return nil, fmt.Errorf("port %d already has a host", port)
+	}
+	ip = net.IPv4(127, 0, 0, byte(2+len(n.hosts))).To4()
+	l, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return nil, fmt.Errorf("loopback address %v not available (add it with `sudo ifconfig lo0 alias %v` on macOS): %w", ip, ip, err)
+	}
+	l.Close()
+	n.hosts[port] = ip
+	return
+}
+
+// The loopback address of the peer listening on the port, Localhost unless it was given one of its own.
+func (n *Network) Host(port int) net.IP {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.host(port)
+}
+
+func (n *Network) host(port int) net.IP {
+	if ip, ok := n.hosts[port]; ok {
+		return ip
+	}
+	return net.ParseIP(Localhost)
+}
+
+// Get the link from the peer listening on port `from` to the one listening on port `to`,
+// creating it (with the default faults) if needed.
+func (n *Network) Link(from int, to int) (l *Link, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, errors.New("network closed")
+	}
+	if l, ok := n.links[[2]int{from, to}]; ok {
+		return l, nil
+	}
+	l = &Link{
+		From:    from,
+		To:      to,
+		network: n,
+		target:  net.JoinHostPort(Localhost, fmt.Sprint(to)),
+		dialer:  net.Dialer{LocalAddr: &net.TCPAddr{IP: n.host(from)}},
+		limiter: rate.NewLimiter(rate.Inf, linkChunkSize),
+		conns:   make(map[*linkConn]struct{}),
+	}
+	l.listener, err = net.Listen("tcp", net.JoinHostPort(n.host(to).String(), "0"))
+	if err != nil {
+		return nil, err
+	}
+	l.Set(n.defaults)
+	n.links[[2]int{from, to}] = l
+	go l.serve()
+	return l, nil
+}
+
+// All links created so far.
+func (n *Network) Links() (links []*Link) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, l := range n.links {
+		links = append(links, l)
+	}
+	return
+}
+
+// Set the faults of every link, including the ones created later.
+func (n *Network) SetAll(faults LinkFaults) {
+	n.mu.Lock()
+	n.defaults = faults
+	n.mu.Unlock()
+	for _, l := range n.Links() {
+		l.Set(faults)
+	}
+}
+
+// Split the peers (by listen port) into groups that cannot reach each other: links across groups go down (as with
+// LinkFaults.Down, without touching the faults set on them), links within a group are left as is.
+// Peers not in any group can still reach everyone. Replaces any previous partition.
+func (n *Network) Partition(groups ...[]int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partition = make(map[int]int)
+	for i, group := range groups {
+		for _, port := range group {
+			n.partition[port] = i
+		}
+	}
+}
+
+// Undo the partition, so every link is back to its own faults.
+func (n *Network) Heal() {
+	n.Partition()
+}
+
+// Cut the peer (by listen port) off from everyone for good, as if its host vanished: every link from or to it goes
+// down, including the ones created later, whatever the partition. Unlike a partition, Heal does not undo it.
+func (n *Network) Isolate(port int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.isolated[port] = true
+}
+
+// Whether the partition (or the isolation of either port) cuts the link from one port to another.
+func (n *Network) partitioned(from int, to int) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.isolated[from] || n.isolated[to] {
+		return true
+	}
+	fromGroup, fromOk := n.partition[from]
+	toGroup, toOk := n.partition[to]
+	return fromOk && toOk && fromGroup != toGroup
+}
+
+// Close every link along with its connections.
+func (n *Network) Close() {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+	for _, l := range n.Links() {
+		l.Close()
+	}
+}
+
+// The address the peer at the start of the link should dial.
+func (l *Link) Addr() *net.TCPAddr {
+	return l.listener.Addr().(*net.TCPAddr)
+}
+
+// Replace the faults injected into the link.
+func (l *Link) Set(faults LinkFaults) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.faults = faults
+	if faults.Bandwidth > 0 {
+		l.limiter.SetLimit(rate.Limit(faults.Bandwidth))
+	} else {
+		l.limiter.SetLimit(rate.Inf)
+	}
+}
+
+// The faults currently injected into the link.
+func (l *Link) Faults() LinkFaults {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.faults
+}
+
+// Whether the link black-holes everything, either by its own faults or by a partition of the network.
+func (l *Link) IsDown() bool {
+	return l.Faults().Down || l.network.partitioned(l.From, l.To)
+}
+
+// Number of connections currently open over the link.
+func (l *Link) NumConns() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.conns)
+}
+
+// When the peer at the start of the link opened each connection over it so far, including the ones the link dropped.
+func (l *Link) Dials() []time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]time.Time{}, l.dials...)
+}
+
+// Abort every connection open over the link with a TCP reset on both ends, as a mid-transfer failure would.
+// New connections are still accepted.
+func (l *Link) Reset() {
+	l.mu.Lock()
+	conns := l.conns
+	l.conns = make(map[*linkConn]struct{})
+	l.mu.Unlock()
+	for c := range conns {
+		c.reset()
+	}
+}
+
+// Stop accepting connections and reset the open ones.
+func (l *Link) Close() {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.listener.Close()
+	l.Reset()
+}
+
+func (l *Link) serve() {
+	for {
+		src, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		l.mu.Lock()
+		l.dials = append(l.dials, time.Now())
+		l.mu.Unlock()
+		go l.handle(src)
+	}
+}
+
+func (l *Link) handle(src net.Conn) {
+	if l.IsDown() || l.network.float64() < l.Faults().ConnDropRate {
+		src.Close()
+		return
+	}
+	dst, err := l.dialer.Dial("tcp", l.target)
+	if err != nil {
+		src.Close()
+		return
+	}
+	c := &linkConn{src: src, dst: dst, done: make(chan struct{})}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		c.reset()
+		return
+	}
+	l.conns[c] = struct{}{}
+	l.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); l.forward(c, dst, src) }()
+	go func() { defer wg.Done(); l.forward(c, src, dst) }()
+	wg.Wait()
+
+	l.mu.Lock()
+	delete(l.conns, c)
+	l.mu.Unlock()
+	src.Close()
+	dst.Close()
+}
+
+// A chunk read from one end, to be written to the other once it is due.
+type linkChunk struct {
+	data []byte
+	due  time.Time
+}
+
+// Forward everything read from src to dst, delaying and rate limiting it according to the faults of the link.
+func (l *Link) forward(c *linkConn, dst net.Conn, src net.Conn) {
+	chunks := make(chan linkChunk, 64)
+	go func() {
+		defer close(chunks)
+		var lastDue time.Time
+		for {
+			buf := make([]byte, linkChunkSize)
+			n, err := src.Read(buf)
+			if n > 0 {
+				faults := l.Faults()
+				delay := faults.Latency
+				if faults.Jitter > 0 {
+					delay += time.Duration(l.network.int63n(int64(faults.Jitter)))
+				}
+				if l.network.float64() < faults.PacketLoss {
+					delay += retransmissionTimeout
+				}
+				// Never deliver a chunk before the previous one
+				due := time.Now().Add(delay)
+				if due.Before(lastDue) {
+					due = lastDue
+				}
+				lastDue = due
+				select {
+				case chunks <- linkChunk{data: buf[:n], due: due}:
+				case <-c.done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for chunk := range chunks {
+		time.Sleep(time.Until(chunk.due))
+		// A link that is down holds on to its data until it comes back up (or the connection is reset)
+		if !l.waitUp(c) {
+			return
+		}
+		l.limiter.WaitN(context.Background(), len(chunk.data))
+		if _, err := dst.Write(chunk.data); err != nil {
+			c.reset()
+			return
+		}
+	}
+	// Propagate the end of the stream, so the other side sees a clean close,
+	// but not through a link that is down (as a black hole lets no FIN through either)
+	if !l.waitUp(c) {
+		return
+	}
+	if tcpConn, ok := dst.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+}
+
+// Wait until the link is up, returning false if the connection is reset in the meantime.
+func (l *Link) waitUp(c *linkConn) bool {
+	for l.IsDown() {
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return true
+}
+
+// Close both ends of the connection with a TCP reset rather than a FIN.
+func (c *linkConn) reset() {
+	c.resetOnce.Do(func() {
+		close(c.done)
+		for _, conn := range []net.Conn{c.src, c.dst} {
+			if tcpConn, ok := conn.(*net.TCPConn); ok {
+				tcpConn.SetLinger(0)
+			}
+			conn.Close()
+		}
+	})
+}
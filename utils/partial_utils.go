@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// How long a partial baseline provider may take to complete its download.
+const partialCompletionTimeout = 5 * time.Minute
+
+// Add a baseline provider to the running swarm holding only the given share of the pieces of the test file (the first
+// ones, none if zero), trusted by the tracker like any other. Joins on a free port if the given one is zero.
+// It does not download the rest until told to (see Torrent.DownloadAll). Only available for a single test file on disk.
+func (s *Swarm) AddPartialBaselineProvider(listenPort int, share float64) (p *Peer) {
+	require.True(s.t, len(s.config.Files) == 0 && !s.config.Virtual, "partial baseline providers need a single test file on disk")
+	require.True(s.t, share >= 0 && share < 1, "share of pieces %v out of [0, 1)", share)
+	info, err := s.MetaInfo.UnmarshalInfo()
+	require.NoError(s.t, err)
+	if listenPort == 0 {
+		listenPort = FreePort(s.t)
+	}
+	p = s.declarePeer(BaselineProvider, listenPort)
+
+	// The content only depends on its seed and offset, so its first bytes are those of a shorter content
+	pieces := int(share * float64(info.NumPieces()))
+	if pieces != 0 {
+		prefix := Content{Seed: s.Content.Seed, Size: int64(pieces) * info.PieceLength}
+		CreateContentFiles(s.t, []string{filepath.Join(p.Config.DataDir, TestFileName)}, prefix)
+	}
+	if s.Tracker != nil {
+		s.Tracker.TrustPort(listenPort)
+	}
+	s.startPeer(p, &s.MetaInfo)
+	fmt.Printf("Added %s on port %d with %d of %d pieces\n", p, listenPort, pieces, info.NumPieces())
+	return
+}
+
+// Wait until the partial baseline provider completed its download, checking meanwhile that neither the tracker nor any
+// of the given peers takes it for a baseline provider. Returns when it completed.
+func (s *Swarm) WaitPartialComplete(bp *Peer, peers []*Peer) (completed time.Time) {
+	fmt.Printf("Waiting for %s to complete\n", bp)
+	infoHash := s.MetaInfo.HashInfoBytes()
+	port := bp.Client.LocalPort()
+	done := make(chan bool, 1)
+	go func() { done <- bp.Client.WaitAll() }()
+	timeout := time.After(partialCompletionTimeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case ok := <-done:
+			require.True(s.t, ok, "%s closed before completing", bp)
+			completed = time.Now()
+			fmt.Printf("%s completed, not taken for a baseline provider until then\n", bp)
+			return
+		case <-timeout:
+			require.FailNow(s.t, "partial baseline provider did not complete", "%s still misses %d bytes", bp, bp.Torrent.BytesMissing())
+		case <-ticker.C:
+			promoted, ok := s.Tracker.BaselineProvider(infoHash)
+			var takenBy *Peer
+			for _, p := range peers {
+				if s.TakesForBaselineProvider(p, bp) {
+					takenBy = p
+					break
+				}
+			}
+			// It may have completed since, before its completion is received above
+			if bp.Torrent.BytesMissing() == 0 {
+				continue
+			}
+			require.False(s.t, ok && promoted.Port == port, "tracker promoted %s before it completed", bp)
+			require.Nil(s.t, takenBy, "%s took %s for its baseline provider before it completed", takenBy, bp)
+		}
+	}
+}
+
+// Verify that the partial baseline provider announced as reliable all along, yet the tracker promoted it and each of the
+// given peers took it for its baseline provider only once it announced the complete file, within a few announce
+// intervals of its completion.
+func VerifyPromotedOnCompletion(t *testing.T, s *Swarm, bp *Peer, completed time.Time, peers []*Peer) {
+	fmt.Printf("Verifying that %s is promoted once complete\n", bp)
+	infoHash := s.MetaInfo.HashInfoBytes()
+	port := bp.Client.LocalPort()
+	require.Eventually(t, func() bool {
+		promoted, ok := s.Tracker.BaselineProvider(infoHash)
+		return ok && promoted.Port == port
+	}, promotionTimeout, promotionTimeout/100, "tracker did not promote %s once complete", bp)
+	fmt.Printf("Tracker promoted %s %v after it completed\n", bp, time.Since(completed).Round(time.Millisecond))
+
+	announcements := s.Tracker.Recorder.ByPort(infoHash)[port]
+	require.NotEmpty(t, announcements)
+	require.NotZero(t, announcements[0].Left, "%s first announced as complete", bp)
+	var announcedComplete bool
+	for _, a := range announcements {
+		require.True(t, a.Reliable, "%s announced as unreliable at %v", bp, a.Time)
+		if a.Left == 0 && !announcedComplete {
+			announcedComplete = true
+			fmt.Printf("%s first announced as complete %v after it completed\n", bp, a.Time.Sub(completed).Round(time.Millisecond))
+		}
+	}
+	require.True(t, announcedComplete, "%s never announced as complete", bp)
+
+	for _, p := range peers {
+		require.Eventually(t, func() bool {
+			return s.TakesForBaselineProvider(p, bp)
+		}, promotionTimeout, promotionTimeout/100, "%s did not take %s for its baseline provider", p, bp)
+		fmt.Printf("%s took %s for its baseline provider %v after it completed\n", p, bp, time.Since(completed).Round(time.Millisecond))
+	}
+	fmt.Printf("SUCCESS: %s promoted once complete\n", bp)
+}
+
+// When the peer opened each connection to another peer so far, in order. Only available if the swarm is proxied.
+func (s *Swarm) Dials(p *Peer) []time.Time {
+	return s.dials(p, func(l *Link) int { return l.From })
+}
+
+// When each connection to the peer was opened by another peer so far, in order. Only available if the swarm is proxied.
+func (s *Swarm) DialsTo(p *Peer) []time.Time {
+	return s.dials(p, func(l *Link) int { return l.To })
+}
+
+// When each connection over a link whose end (as picked by end) is the peer was opened, in order.
+func (s *Swarm) dials(p *Peer, end func(l *Link) int) (dials []time.Time) {
+	require.NotNil(s.t, s.Network, "swarm is not proxied")
+	for _, l := range s.Network.Links() {
+		if end(l) == p.Client.LocalPort() {
+			dials = append(dials, l.Dials()...)
+		}
+	}
+	sort.Slice(dials, func(i, j int) bool { return dials[i].Before(dials[j]) })
+	return
+}
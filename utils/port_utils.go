@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"rbtValidation/tracker"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// How many times to look for a free port before giving up.
+const maxPortAttempts = 100
+
+// Ports handed out to tests that have not finished yet, so no two tests running in parallel share one.
+var allocatedPorts = struct {
+	sync.Mutex
+	ports map[int]bool
+}{ports: make(map[int]bool)}
+
+// Allocate a port that is free for both TCP and UDP (a client listens on both), for a peer to listen on.
+// The port is not handed out again until the test finishes, so tests can run in parallel (see t.Parallel).
+func FreePort(t *testing.T) int {
+	for attempt := 0; attempt < maxPortAttempts; attempt++ {
+		port, err := freePort()
+		if err != nil {
+			continue
+		}
+		allocatedPorts.Lock()
+		taken := allocatedPorts.ports[port]
+		allocatedPorts.ports[port] = true
+		allocatedPorts.Unlock()
+		if taken {
+			continue
+		}
+		t.Cleanup(func() {
+			allocatedPorts.Lock()
+			defer allocatedPorts.Unlock()
+			delete(allocatedPorts.ports, port)
+		})
+		return port
+	}
+	require.FailNow(t, "no free port", "found no free port after %d attempts", maxPortAttempts)
+	return 0
+}
+
+// Allocate n free ports, see FreePort.
+func FreePorts(t *testing.T, n int) (ports []int) {
+	for i := 0; i < n; i++ {
+		ports = append(ports, FreePort(t))
+	}
+	return
+}
+
+// Allocate a free port (see FreePort) and trust peers listening on it to act as baseline providers with the tracker.
+func TrustedPort(t *testing.T, tr *tracker.Tracker) (port int) {
+	port = FreePort(t)
+	tr.TrustPort(port)
+	return
+}
+
+// Let the OS pick a TCP port, and check the same port is free for UDP.
+func freePort() (port int, err error) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return
+	}
+	defer l.Close()
+	port = l.Addr().(*net.TCPAddr).Port
+	u, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return
+	}
+	u.Close()
+	return
+}
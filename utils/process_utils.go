@@ -0,0 +1,252 @@
+//go:build unix
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// Environment variable pointing to a prebuilt rbtpeer binary, otherwise it is built from cmd/rbtpeer once per run.
+	PeerBinEnv = "RBT_PEER_BIN"
+	// Paths served by the control socket of a peer process.
+	StatsPath    = "/stats"
+	DownloadPath = "/download"
+	// How long a peer process may take to start serving its control socket, or to exit once terminated.
+	processTimeout = 30 * time.Second
+)
+
+// Client of the control sockets, which gives up on a frozen peer rather than hanging.
+var controlClient = &http.Client{Timeout: 5 * time.Second}
+
+// The state of a peer process, as served on its control socket.
+type PeerStats struct {
+	Sample
+	Role string
+	// Listen port of the client
+	Port int
+	// Total length of the torrent
+	Length int64
+}
+
+// Whether the peer holds the complete torrent.
+func (s PeerStats) Complete() bool {
+	return s.Length != 0 && s.BytesCompleted == s.Length
+}
+
+// Declaration of a peer process.
+type ProcessConfig struct {
+	Role Role
+	// Data directory of the peer, holding the complete test file for a seeder or baseline provider
+	DataDir string
+	// Path to the .torrent file of the test file, see WriteTorrentFile
+	TorrentFile string
+	// Listen port, a free one is picked if zero
+	Port int
+	// Upload and download rate limits in bytes per second, unlimited if zero
+	UploadRate   float64
+	DownloadRate float64
+}
+
+// A peer running the rbtpeer binary in a process of its own, controlled through a local control socket.
+// Unlike a peer of a swarm, it has its own scheduler and memory, and can be killed or frozen by a signal.
+type PeerProcess struct {
+	t      *testing.T
+	Config ProcessConfig
+	// Address of the control socket
+	ControlAddr string
+	// Where the output of the process goes
+	LogPath string
+
+	cmd    *exec.Cmd
+	exited chan struct{}
+	err    error
+}
+
+// The rbtpeer binary, built at most once per run.
+var peerBin struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// Return the path of the rbtpeer binary, building it on first use unless PeerBinEnv points to one.
+func PeerBinary(t *testing.T) string {
+	if path := os.Getenv(PeerBinEnv); path != "" {
+		return path
+	}
+	peerBin.once.Do(func() {
+		dir, err := os.MkdirTemp("", "rbtpeer-")
+		if err != nil {
+			peerBin.err = err
+			return
+		}
+		peerBin.path = filepath.Join(dir, "rbtpeer")
+		out, err := exec.Command("go", "build", "-o", peerBin.path, "rbtValidation/cmd/rbtpeer").CombinedOutput()
+		if err != nil {
+			peerBin.err = fmt.Errorf("%w: %s", err, out)
+		}
+	})
+	require.NoError(t, peerBin.err, "building rbtpeer")
+	return peerBin.path
+}
+
+// Write the metainfo into a .torrent file at the given path, to be handed to peer processes.
+func WriteTorrentFile(t *testing.T, metaInfo *metainfo.MetaInfo, path string) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, metaInfo.Write(f))
+}
+
+// Start a peer process as declared by the config, and wait until it serves its control socket.
+// The process is killed, if still running, when the test finishes.
+func StartPeerProcess(t *testing.T, config ProcessConfig) (p *PeerProcess) {
+	if config.Port == 0 {
+		config.Port = FreePort(t)
+	}
+	p = &PeerProcess{
+		t:           t,
+		Config:      config,
+		ControlAddr: fmt.Sprintf("%s:%d", Localhost, FreePort(t)),
+		LogPath:     config.DataDir + ".log",
+		exited:      make(chan struct{}),
+	}
+	CreateDir(t, config.DataDir)
+	logFile, err := os.Create(p.LogPath)
+	require.NoError(t, err)
+
+	p.cmd = exec.Command(PeerBinary(t),
+		"-role", config.Role.Name(),
+		"-data-dir", config.DataDir,
+		"-torrent", config.TorrentFile,
+		"-port", strconv.Itoa(config.Port),
+		"-upload-rate", fmt.Sprint(config.UploadRate),
+		"-download-rate", fmt.Sprint(config.DownloadRate),
+		"-control", p.ControlAddr,
+	)
+	p.cmd.Stdout, p.cmd.Stderr = logFile, logFile
+	require.NoError(t, p.cmd.Start(), "starting %s", p)
+	go func() {
+		p.err = p.cmd.Wait()
+		logFile.Close()
+		close(p.exited)
+	}()
+	t.Cleanup(func() {
+		if !p.Exited() {
+			p.cmd.Process.Signal(syscall.SIGKILL)
+			<-p.exited
+		}
+		if t.Failed() {
+			t.Logf("Output of %s is in %s", p, p.LogPath)
+		}
+	})
+
+	require.Eventually(t, func() bool {
+		_, err := p.Stats()
+		return err == nil || p.Exited()
+	}, processTimeout, processTimeout/300, "%s did not start serving its control socket", p)
+	require.False(t, p.Exited(), "%s exited right away: %v, see %s", p, p.err, p.LogPath)
+	return
+}
+
+func (p *PeerProcess) String() string {
+	return fmt.Sprintf("%s process on port %d", p.Config.Role, p.Config.Port)
+}
+
+// Query the current state of the peer over its control socket.
+func (p *PeerProcess) Stats() (stats PeerStats, err error) {
+	resp, err := controlClient.Get("http://" + p.ControlAddr + StatsPath)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return stats, fmt.Errorf("stats of %s: %s", p, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	return
+}
+
+// Start downloading the whole torrent. Fails if the control socket does not answer.
+func (p *PeerProcess) Download() {
+	resp, err := controlClient.Post("http://"+p.ControlAddr+DownloadPath, "", nil)
+	require.NoError(p.t, err, "starting download of %s", p)
+	resp.Body.Close()
+	require.Equal(p.t, http.StatusOK, resp.StatusCode, "starting download of %s", p)
+}
+
+// Wait until the peer holds the complete torrent. Fails if it does not within the timeout, or exits.
+func (p *PeerProcess) WaitComplete(timeout time.Duration) (stats PeerStats) {
+	require.Eventually(p.t, func() bool {
+		var err error
+		stats, err = p.Stats()
+		return (err == nil && stats.Complete()) || p.Exited()
+	}, timeout, DefaultSampleInterval, "%s did not complete", p)
+	require.False(p.t, p.Exited(), "%s exited before completing: %v", p, p.err)
+	return
+}
+
+// Send a signal to the process.
+func (p *PeerProcess) Signal(sig syscall.Signal) {
+	fmt.Printf("Sending signal %d (%v) to %s\n", sig, sig, p)
+	require.NoError(p.t, p.cmd.Process.Signal(sig), "signalling %s", p)
+}
+
+// Ask the peer to shut down cleanly (SIGTERM) and wait for it to exit.
+func (p *PeerProcess) Terminate() {
+	p.Signal(syscall.SIGTERM)
+	p.Wait(processTimeout)
+}
+
+// Kill the peer abruptly (SIGKILL), as a crash would: its connections are torn down by the OS, without any goodbye.
+// Waits for the process to exit.
+func (p *PeerProcess) Kill() {
+	p.Signal(syscall.SIGKILL)
+	p.Wait(processTimeout)
+}
+
+// Freeze the peer (SIGSTOP): its connections stay open but nothing is sent or read, as a hung host would.
+func (p *PeerProcess) Freeze() {
+	p.Signal(syscall.SIGSTOP)
+}
+
+// Resume a frozen peer (SIGCONT).
+func (p *PeerProcess) Resume() {
+	p.Signal(syscall.SIGCONT)
+}
+
+// Whether the process has exited.
+func (p *PeerProcess) Exited() bool {
+	select {
+	case <-p.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait until the process exits, and return its exit error (nil if it exited cleanly).
+// Fails if it does not exit within the timeout.
+func (p *PeerProcess) Wait(timeout time.Duration) error {
+	select {
+	case <-p.exited:
+		return p.err
+	case <-time.After(timeout):
+		require.FailNow(p.t, "process still running", "%s did not exit within %v", p, timeout)
+		return nil
+	}
+}
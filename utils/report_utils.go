@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// Environment variable overriding the directory experiment reports are written to.
+	ResultsDirEnv = "RBT_RESULTS_DIR"
+	// Directory experiment reports are written to by default, relative to the package under test.
+	DefaultResultsDir = "results"
+)
+
+// What one peer did during an experiment.
+type PeerReport struct {
+	Name string `json:"name"`
+	// One of "seeder", "baseline_provider" or "leecher", as in scenarios
+	Role string `json:"role"`
+	Port int    `json:"port"`
+	// Initial upload and download rate limits in bytes per second, zero if unlimited
+	UploadRate   float64 `json:"upload_rate"`
+	DownloadRate float64 `json:"download_rate"`
+	// Seconds from the start of its download to its first useful byte and to its complete file, null if it never got there
+	TimeToFirstByte *float64 `json:"time_to_first_byte"`
+	TimeToComplete  *float64 `json:"time_to_complete"`
+	Uploaded        int64    `json:"uploaded"`
+	Downloaded      int64    `json:"downloaded"`
+	// Useful bytes received from each peer, and from each role (UnknownSender for unregistered peers)
+	BytesFromPeers map[string]int64 `json:"bytes_from_peers"`
+	BytesFromRoles map[string]int64 `json:"bytes_from_roles"`
+}
+
+// A machine-readable summary of an experiment, to compare runs without reading their output.
+type Report struct {
+	Name     string    `json:"name"`
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration"`
+	FileSize int64     `json:"file_size"`
+	// Seed of the test file content, see TestSeed
+	Seed        int64        `json:"seed"`
+	PieceLength int64        `json:"piece_length"`
+	NoTracker   bool         `json:"no_tracker"`
+	Passed      bool         `json:"passed"`
+	Peers       []PeerReport `json:"peers"`
+}
+
+// The directory experiment reports are written to, see ResultsDirEnv.
+func ResultsDir() string {
+	if dir := os.Getenv(ResultsDirEnv); dir != "" {
+		return dir
+	}
+	return DefaultResultsDir
+}
+
+// Seconds elapsed between two points in time, as reported.
+func seconds(from time.Time, to time.Time) *float64 {
+	s := to.Sub(from).Seconds()
+	return &s
+}
+
+// Write the report as <name>.json, along with one CSV row per peer in <name>.csv, into the given directory.
+func (r Report) Write(dir string) (err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return
+	}
+	if err = os.WriteFile(filepath.Join(dir, r.Name+".json"), b, 0644); err != nil {
+		return
+	}
+
+	f, err := os.Create(filepath.Join(dir, r.Name+".csv"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{
+		"scenario", "passed", "file_size", "piece_length", "peer", "role", "port", "upload_rate", "download_rate",
+		"time_to_first_byte", "time_to_complete", "uploaded", "downloaded",
+		"from_seeders", "from_baseline_providers", "from_leechers", "from_unknown",
+	})
+	optional := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', 3, 64)
+	}
+	for _, p := range r.Peers {
+		w.Write([]string{
+			r.Name, strconv.FormatBool(r.Passed), fmt.Sprint(r.FileSize), fmt.Sprint(r.PieceLength),
+			p.Name, p.Role, fmt.Sprint(p.Port), fmt.Sprint(p.UploadRate), fmt.Sprint(p.DownloadRate),
+			optional(p.TimeToFirstByte), optional(p.TimeToComplete), fmt.Sprint(p.Uploaded), fmt.Sprint(p.Downloaded),
+			fmt.Sprint(p.BytesFromRoles["seeder"]), fmt.Sprint(p.BytesFromRoles["baseline_provider"]),
+			fmt.Sprint(p.BytesFromRoles["leecher"]), fmt.Sprint(p.BytesFromRoles[UnknownSender]),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
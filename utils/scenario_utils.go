@@ -0,0 +1,552 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+// Actions that can appear on the timeline of a scenario.
+const (
+	// Start downloading on the given leechers (all leechers if none is given).
+	ActionDownload = "download"
+	// Bring a peer declared with join_later into the swarm.
+	ActionJoin = "join"
+	// Close a peer gracefully, so it tells the tracker it stopped (see Peer.Close).
+	ActionKill = "kill"
+	// Crash a peer abruptly, without its connections or the tracker hearing about it (see Swarm.Crash).
+	// A scenario with a crash runs its swarm proxied.
+	ActionCrash = "crash"
+	// Tell a peer that joined trackerless about the tracker.
+	ActionAddTrackers = "add_trackers"
+	// Change the upload and/or download rate limit of a peer.
+	ActionThrottle = "throttle"
+	// Let a peer know about another peer directly, without going through the tracker.
+	ActionConnect = "connect"
+)
+
+// A duration written as a string such as "3s" or "1m30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	*d = Duration(parsed)
+	return err
+}
+
+// A peer of a scenario.
+type ScenarioPeer struct {
+	Name string `json:"name" yaml:"name"`
+	// One of "seeder", "baseline_provider" or "leecher".
+	Role string `json:"role" yaml:"role"`
+	// Listen port, a free one is picked if zero.
+	Port int `json:"port" yaml:"port"`
+	// For a baseline provider, whether the tracker should not trust it.
+	Untrusted bool `json:"untrusted" yaml:"untrusted"`
+	// Do not start the peer with the swarm, but only once a join event names it.
+	JoinLater bool `json:"join_later" yaml:"join_later"`
+	// Upload and download rate limits in bytes per second, unlimited if zero.
+	UploadRate   float64 `json:"upload_rate" yaml:"upload_rate"`
+	DownloadRate float64 `json:"download_rate" yaml:"download_rate"`
+}
+
+// An event on the timeline of a scenario.
+type ScenarioEvent struct {
+	// Time of the event, relative to the moment the initial swarm is up.
+	At     Duration `json:"at" yaml:"at"`
+	Action string   `json:"action" yaml:"action"`
+	// Names of the peers the action applies to.
+	Peers []string `json:"peers" yaml:"peers"`
+	// For join, whether the peer joins without knowing about the tracker.
+	Trackerless bool `json:"trackerless" yaml:"trackerless"`
+	// For connect, the names of the peers to be made known to the peers above.
+	To []string `json:"to" yaml:"to"`
+	// For throttle, the new rate limits in bytes per second (zero lifts a limit, leaving one out keeps it as is).
+	// A peer is all but stopped by a rate of 1.
+	UploadRate   *float64 `json:"upload_rate" yaml:"upload_rate"`
+	DownloadRate *float64 `json:"download_rate" yaml:"download_rate"`
+}
+
+// The baseline providers (by name) a group of peers must know about, none if empty, as checked by
+// VerifySwarmBaselineProvider.
+type ScenarioBaselineProviderExpectation struct {
+	Peers             []string `json:"peers" yaml:"peers"`
+	BaselineProviders []string `json:"baseline_providers" yaml:"baseline_providers"`
+}
+
+// The assertions checked at the end of a scenario.
+type ScenarioExpectation struct {
+	// Leechers that must complete their download (and hold the correct content) within the timeout, all leechers if empty.
+	Complete []string `json:"complete" yaml:"complete"`
+	// Leechers that must not complete their download within the timeout.
+	Incomplete []string `json:"incomplete" yaml:"incomplete"`
+	// How long to wait for downloads, counted from the last event of the timeline.
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+	// Peers that must have uploaded something by the end of the scenario.
+	Uploaded []string `json:"uploaded" yaml:"uploaded"`
+	// Baseline providers each group of peers must know about at the end of the scenario.
+	BaselineProvider []ScenarioBaselineProviderExpectation `json:"baseline_provider" yaml:"baseline_provider"`
+}
+
+// A scenario describing a swarm, a timeline of events and the expected outcome.
+type Scenario struct {
+	Name string `json:"name" yaml:"name"`
+	// Size of the test file in bytes (may be written as e.g. 1e7).
+	FileSize float64 `json:"file_size" yaml:"file_size"`
+	// Piece length of the torrent in bytes, utils.PieceLength if zero.
+	PieceLength int64 `json:"piece_length" yaml:"piece_length"`
+	// Do not start a tracker, peers then only know each other through connect events.
+	NoTracker bool `json:"no_tracker" yaml:"no_tracker"`
+	// Have the tracker drop peers that stopped announcing for this long, so a dead baseline provider gets replaced.
+	TrackerPeerTimeout Duration            `json:"tracker_peer_timeout" yaml:"tracker_peer_timeout"`
+	Peers              []ScenarioPeer      `json:"peers" yaml:"peers"`
+	Timeline           []ScenarioEvent     `json:"timeline" yaml:"timeline"`
+	Expect             ScenarioExpectation `json:"expect" yaml:"expect"`
+}
+
+// Load a scenario from a YAML (.yaml, .yml) or JSON (.json) file.
+// The scenario is named after the file if it does not name itself.
+func LoadScenario(path string) (scenario Scenario, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &scenario)
+	case ".json":
+		err = json.Unmarshal(b, &scenario)
+	default:
+		err = fmt.Errorf("unknown scenario file extension %q", ext)
+	}
+	if err != nil {
+		return
+	}
+	if scenario.Name == "" {
+		scenario.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	err = scenario.validate()
+	return
+}
+
+// Check the scenario for unknown roles, actions and peer names.
+func (sc *Scenario) validate() error {
+	roles := make(map[string]string)
+	for _, p := range sc.Peers {
+		if _, err := ParseRole(p.Role); err != nil {
+			return fmt.Errorf("peer %q: %w", p.Name, err)
+		}
+		if _, ok := roles[p.Name]; ok {
+			return fmt.Errorf("peer %q declared twice", p.Name)
+		}
+		roles[p.Name] = p.Role
+	}
+	checkNames := func(context string, names []string) error {
+		for _, name := range names {
+			if _, ok := roles[name]; !ok {
+				return fmt.Errorf("%s: unknown peer %q", context, name)
+			}
+		}
+		return nil
+	}
+	for i, e := range sc.Timeline {
+		context := fmt.Sprintf("event %d (%s)", i, e.Action)
+		switch e.Action {
+		case ActionDownload, ActionJoin, ActionKill, ActionCrash, ActionAddTrackers, ActionThrottle, ActionConnect:
+		default:
+			return fmt.Errorf("%s: unknown action", context)
+		}
+		if err := checkNames(context, e.Peers); err != nil {
+			return err
+		}
+		if err := checkNames(context, e.To); err != nil {
+			return err
+		}
+	}
+	if sc.PieceLength < 0 {
+		return fmt.Errorf("negative piece length %d", sc.PieceLength)
+	}
+	if len(sc.Expect.Incomplete) != 0 && sc.Expect.Timeout == 0 {
+		return errors.New("expecting incomplete leechers requires a timeout")
+	}
+	for _, names := range [][]string{sc.Expect.Complete, sc.Expect.Incomplete, sc.Expect.Uploaded} {
+		if err := checkNames("expect", names); err != nil {
+			return err
+		}
+	}
+	for _, bp := range sc.Expect.BaselineProvider {
+		if err := checkNames("expect baseline_provider", bp.Peers); err != nil {
+			return err
+		}
+		if err := checkNames("expect baseline_provider", bp.BaselineProviders); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parse a role as named in scenarios, see Role.Name.
+func ParseRole(role string) (Role, error) {
+	switch role {
+	case "seeder":
+		return Seeder, nil
+	case "baseline_provider":
+		return BaselineProvider, nil
+	case "leecher":
+		return Leecher, nil
+	}
+	return 0, fmt.Errorf("unknown role %q", role)
+}
+
+// The state of a running scenario.
+type scenarioRun struct {
+	t        *testing.T
+	scenario Scenario
+	swarm    *Swarm
+	specs    map[string]ScenarioPeer
+	peers    map[string]*Peer
+	// Names of the peers of each role in the order the swarm declares them, so each can be matched to its spec (see
+	// configure) before its client starts
+	names map[Role][]string
+	// Rate limiters of every started peer, so they can be throttled at runtime
+	uploadLimiters   map[*Peer]*rate.Limiter
+	downloadLimiters map[*Peer]*rate.Limiter
+	// When each leecher was told to download, and when it completed, for the report
+	started          time.Time
+	downloadsStarted map[string]time.Time
+	completed        map[string]time.Time
+}
+
+// Run a scenario: set up the swarm, play the timeline and check the expectations.
+func RunScenario(t *testing.T, scenario Scenario) {
+	runScenario(t, scenario, nil)
+}
+
+// Run a scenario, handing its report (once written, even if the scenario failed) to onReport if not nil.
+func runScenario(t *testing.T, scenario Scenario, onReport func(r Report)) {
+	fmt.Printf("Running scenario %s\n", scenario.Name)
+	run := &scenarioRun{
+		t:                t,
+		scenario:         scenario,
+		specs:            make(map[string]ScenarioPeer),
+		peers:            make(map[string]*Peer),
+		names:            make(map[Role][]string),
+		uploadLimiters:   make(map[*Peer]*rate.Limiter),
+		downloadLimiters: make(map[*Peer]*rate.Limiter),
+		started:          time.Now(),
+		downloadsStarted: make(map[string]time.Time),
+		completed:        make(map[string]time.Time),
+	}
+
+	// Peers of each role are started in declaration order (trusted baseline providers before untrusted ones),
+	// so they can be matched back to their names
+	config := SwarmConfig{
+		FileSize:           int64(scenario.FileSize),
+		PieceLength:        scenario.PieceLength,
+		NoTracker:          scenario.NoTracker,
+		TrackerPeerTimeout: time.Duration(scenario.TrackerPeerTimeout),
+		Configure:          run.configure,
+		SmallInterval:      true,
+	}
+	for _, e := range scenario.Timeline {
+		if e.Action == ActionCrash {
+			config.Proxied = true
+		}
+	}
+	var untrusted []string
+	for _, spec := range scenario.Peers {
+		run.specs[spec.Name] = spec
+		if spec.JoinLater {
+			continue
+		}
+		role, _ := ParseRole(spec.Role)
+		switch {
+		case role == Seeder:
+			config.Seeders++
+			config.SeederPorts = append(config.SeederPorts, spec.Port)
+		case role == BaselineProvider && spec.Untrusted:
+			config.FakeBaselineProviderPorts = append(config.FakeBaselineProviderPorts, spec.Port)
+			untrusted = append(untrusted, spec.Name)
+			continue
+		case role == BaselineProvider:
+			config.BaselineProviderPorts = append(config.BaselineProviderPorts, spec.Port)
+		case role == Leecher:
+			config.Leechers++
+			config.LeecherPorts = append(config.LeecherPorts, spec.Port)
+		}
+		run.names[role] = append(run.names[role], spec.Name)
+	}
+	run.names[BaselineProvider] = append(run.names[BaselineProvider], untrusted...)
+
+	run.swarm = NewSwarm(t, config)
+	// Registered after the swarm, so the report is written before the peers are torn down
+	t.Cleanup(func() {
+		r := run.writeReport()
+		if onReport != nil {
+			onReport(r)
+		}
+	})
+	for role, names := range run.names {
+		for i, name := range names {
+			run.peers[name] = run.swarm.Peers(role)[i]
+		}
+	}
+
+	// Play the timeline
+	timeline := append([]ScenarioEvent{}, scenario.Timeline...)
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].At < timeline[j].At })
+	start := time.Now()
+	for _, e := range timeline {
+		time.Sleep(time.Until(start.Add(time.Duration(e.At))))
+		fmt.Printf("[%v] %s %v\n", time.Since(start).Round(time.Millisecond), e.Action, e.Peers)
+		run.play(e)
+	}
+
+	run.verify()
+}
+
+// Give each peer its own rate limiters, so throttling one does not affect the others, set to the limits of its spec
+// along with the trust it declares, so both hold from the moment its client starts.
+func (run *scenarioRun) configure(p *Peer) {
+	run.uploadLimiters[p] = rate.NewLimiter(rate.Inf, DefaultChunkSize)
+	run.downloadLimiters[p] = rate.NewLimiter(rate.Inf, DefaultChunkSize)
+	p.Config.UploadRateLimiter = run.uploadLimiters[p]
+	p.Config.DownloadRateLimiter = run.downloadLimiters[p]
+	if names := run.names[p.Role]; p.ID < len(names) {
+		spec := run.specs[names[p.ID]]
+		run.limit(p, &spec.UploadRate, &spec.DownloadRate)
+		p.Untrusted = spec.Untrusted
+	}
+}
+
+// Apply an event of the timeline.
+func (run *scenarioRun) play(e ScenarioEvent) {
+	switch e.Action {
+	case ActionDownload:
+		names := e.Peers
+		if len(names) == 0 {
+			for name, p := range run.peers {
+				if p.Role == Leecher {
+					names = append(names, name)
+				}
+			}
+		}
+		for _, name := range names {
+			run.peer(name).Torrent.DownloadAll()
+			run.downloadsStarted[name] = time.Now()
+		}
+	case ActionJoin:
+		for _, name := range e.Peers {
+			spec := run.specs[name]
+			require.Nil(run.t, run.peers[name], "peer %s joined twice", name)
+			role, _ := ParseRole(spec.Role)
+			run.names[role] = append(run.names[role], name)
+			if e.Trackerless {
+				run.peers[name] = run.swarm.AddTrackerlessPeer(role, spec.Port)
+			} else {
+				run.peers[name] = run.swarm.AddPeer(role, spec.Port)
+			}
+		}
+	case ActionKill:
+		for _, name := range e.Peers {
+			p := run.peer(name)
+			fmt.Printf("%s uploaded %d bytes, downloaded %d bytes before being killed\n", name, p.Torrent.UploadedBytes(), p.Torrent.DownloadedBytes())
+			p.Close()
+		}
+	case ActionCrash:
+		for _, name := range e.Peers {
+			p := run.peer(name)
+			fmt.Printf("%s uploaded %d bytes, downloaded %d bytes before crashing\n", name, p.Torrent.UploadedBytes(), p.Torrent.DownloadedBytes())
+			run.swarm.Crash(p)
+		}
+	case ActionAddTrackers:
+		for _, name := range e.Peers {
+			run.swarm.AddTrackers(run.peer(name))
+		}
+	case ActionThrottle:
+		for _, name := range e.Peers {
+			run.limit(run.peer(name), e.UploadRate, e.DownloadRate)
+		}
+	case ActionConnect:
+		for _, name := range e.Peers {
+			for _, to := range e.To {
+				run.swarm.Connect(run.peer(name), run.peer(to))
+			}
+		}
+	}
+}
+
+// Check the expectations of the scenario once the timeline has been played.
+func (run *scenarioRun) verify() {
+	expect := run.scenario.Expect
+	complete := expect.Complete
+	if len(complete) == 0 && len(expect.Incomplete) == 0 {
+		for _, spec := range run.scenario.Peers {
+			if spec.Role == "leecher" {
+				complete = append(complete, spec.Name)
+			}
+		}
+	}
+
+	// Wait for every leecher that is expected to complete, and until the timeout if some are expected not to
+	watched := append(append([]string{}, complete...), expect.Incomplete...)
+	done := make(chan string, len(watched))
+	for _, name := range watched {
+		client := run.peer(name).Client
+		go func(name string) {
+			if client.WaitAll() {
+				done <- name
+			}
+		}(name)
+	}
+	var timeout <-chan time.Time
+	if expect.Timeout != 0 {
+		timeout = time.After(time.Duration(expect.Timeout))
+	}
+	finished := make(map[string]bool)
+	for waiting := len(watched) != 0; waiting; {
+		select {
+		case name := <-done:
+			finished[name] = true
+			run.completed[name] = time.Now()
+			for _, incomplete := range expect.Incomplete {
+				require.NotEqual(run.t, incomplete, name, "%s should not have completed", name)
+			}
+			waiting = len(finished) < len(complete) || len(expect.Incomplete) != 0
+		case <-timeout:
+			require.Equal(run.t, len(complete), len(finished), "scenario timed out with %v completed, expecting %v", finished, complete)
+			waiting = false
+		}
+	}
+
+	for _, name := range expect.Uploaded {
+		uploaded := run.peer(name).Torrent.UploadedBytes()
+		fmt.Printf("%s uploaded %d bytes\n", name, uploaded)
+		require.NotZero(run.t, uploaded, "%s should have uploaded", name)
+	}
+
+	for _, bp := range expect.BaselineProvider {
+		var peers, bps []*Peer
+		for _, name := range bp.Peers {
+			peers = append(peers, run.peer(name))
+		}
+		for _, name := range bp.BaselineProviders {
+			bps = append(bps, run.peer(name))
+		}
+		VerifySwarmBaselineProvider(run.t, run.swarm, peers, bps)
+	}
+
+	if len(complete) != 0 {
+		var dirs []string
+		for _, name := range complete {
+			dirs = append(dirs, run.peer(name).Config.DataDir)
+		}
+		VerifyPieces(run.t, &run.swarm.MetaInfo, dirs)
+	}
+	fmt.Printf("SUCCESS: Scenario %s met its expectations\n", run.scenario.Name)
+}
+
+// The started peer of the given name, failing if it has not joined.
+func (run *scenarioRun) peer(name string) *Peer {
+	p, ok := run.peers[name]
+	require.True(run.t, ok, "peer %s has not joined the swarm", name)
+	return p
+}
+
+// Change the rate limits of a peer, in bytes per second.
+// A nil rate leaves the limit as is, zero lifts it.
+func (run *scenarioRun) limit(p *Peer, uploadRate *float64, downloadRate *float64) {
+	for _, l := range []struct {
+		limiter *rate.Limiter
+		rate    *float64
+	}{
+		{run.uploadLimiters[p], uploadRate},
+		{run.downloadLimiters[p], downloadRate},
+	} {
+		switch {
+		case l.rate == nil:
+		case *l.rate == 0:
+			l.limiter.SetLimit(rate.Inf)
+		default:
+			l.limiter.SetLimit(rate.Limit(*l.rate))
+		}
+	}
+}
+
+// Summarize the run into a report, see Report.
+func (run *scenarioRun) report() Report {
+	r := Report{
+		Name:      run.scenario.Name,
+		Started:   run.started,
+		Duration:  time.Since(run.started).Seconds(),
+		FileSize:  int64(run.scenario.FileSize),
+		Seed:      TestSeed(run.t),
+		NoTracker: run.scenario.NoTracker,
+		Passed:    !run.t.Failed(),
+	}
+	if info, err := run.swarm.MetaInfo.UnmarshalInfo(); err == nil {
+		r.PieceLength = info.PieceLength
+	}
+	// The ledger knows peers by their swarm names
+	names := make(map[string]string)
+	for name, p := range run.peers {
+		names[p.String()] = name
+	}
+	for _, spec := range run.scenario.Peers {
+		pr := PeerReport{
+			Name:           spec.Name,
+			Role:           spec.Role,
+			Port:           spec.Port,
+			UploadRate:     spec.UploadRate,
+			DownloadRate:   spec.DownloadRate,
+			BytesFromPeers: make(map[string]int64),
+			BytesFromRoles: make(map[string]int64),
+		}
+		p, joined := run.peers[spec.Name]
+		if joined {
+			pr.Port = p.Client.LocalPort()
+			pr.Uploaded = p.Torrent.UploadedBytes()
+			pr.Downloaded = p.Torrent.DownloadedBytes()
+			for from, bytes := range run.swarm.Ledger.BytesBySender(p.String()) {
+				role := UnknownSender
+				if name, ok := names[from]; ok {
+					from, role = name, run.specs[name].Role
+				}
+				pr.BytesFromPeers[from] += bytes
+				pr.BytesFromRoles[role] += bytes
+			}
+			if started, ok := run.downloadsStarted[spec.Name]; ok {
+				if first, ok := run.swarm.Ledger.FirstReceipt(p.String()); ok {
+					pr.TimeToFirstByte = seconds(started, first)
+				}
+				if completed, ok := run.completed[spec.Name]; ok {
+					pr.TimeToComplete = seconds(started, completed)
+				}
+			}
+		}
+		r.Peers = append(r.Peers, pr)
+	}
+	return r
+}
+
+// Write the report of the run into the results directory, and return it.
+func (run *scenarioRun) writeReport() (r Report) {
+	dir := ResultsDir()
+	r = run.report()
+	if err := r.Write(dir); err != nil {
+		run.t.Errorf("writing report of scenario %s: %v", run.scenario.Name, err)
+		return
+	}
+	fmt.Printf("Report of scenario %s written to %s\n", run.scenario.Name, dir)
+	return
+}
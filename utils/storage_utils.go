@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// Number of content blocks a virtual storage keeps cached.
+const virtualCacheBlocks = 64
+
+// A storage for the torrent client that keeps no copy of the test file: a complete peer generates the pieces it serves
+// from the seeded content, and a peer downloading only buffers the pieces it has not completed yet, as a piece passing
+// its hash check holds exactly the seeded content (which it is served from afterwards).
+// Lets tests share large files without the disk space for a copy per peer.
+type VirtualStorage struct {
+	content  Content
+	complete bool
+
+	mu        sync.Mutex
+	numPieces int
+	// Data received for each piece not completed yet
+	buffers map[int][]byte
+	// Pieces that passed their hash check
+	completed map[int]bool
+	// Completed pieces whose data did not match the content after all
+	mismatched []int
+
+	cache *blockCache
+}
+
+// Recently generated blocks of a content, as chunks are read a fraction of a block at a time.
+// Storages of the same content can share one (see VirtualStorage.ShareCache), so a large swarm does not keep one per peer.
+type blockCache struct {
+	content Content
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+// A virtual piece of a torrent opened from a virtual storage.
+type virtualPiece struct {
+	s     *VirtualStorage
+	piece metainfo.Piece
+}
+
+// Create a virtual storage holding the given content, either complete (as for a seeder) or empty.
+func NewVirtualStorage(content Content, complete bool) *VirtualStorage {
+	return &VirtualStorage{
+		content:   content,
+		complete:  complete,
+		buffers:   make(map[int][]byte),
+		completed: make(map[int]bool),
+		cache:     &blockCache{content: content, blocks: make(map[int64][]byte)},
+	}
+}
+
+// Read the content through the block cache of another storage of the same content from now on.
+func (s *VirtualStorage) ShareCache(other *VirtualStorage) {
+	if s.content != other.content {
+		panic(fmt.Sprintf("sharing the cache of content %v with content %v", other.content, s.content))
+	}
+	s.cache = other.cache
+}
+
+// Open a torrent, which must share the content of the storage (as one created by CreateVirtualMetaInfo).
+func (s *VirtualStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	if info.TotalLength() != s.content.Size {
+		return storage.TorrentImpl{}, fmt.Errorf("torrent of %d bytes does not match content of %d bytes", info.TotalLength(), s.content.Size)
+	}
+	s.mu.Lock()
+	s.numPieces = info.NumPieces()
+	s.mu.Unlock()
+	return storage.TorrentImpl{
+		Piece: func(p metainfo.Piece) storage.PieceImpl { return virtualPiece{s: s, piece: p} },
+		Close: func() error { return nil },
+	}, nil
+}
+
+// Number of pieces that are complete, either from the start or once they passed their hash check.
+func (s *VirtualStorage) NumCompleted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.complete {
+		return s.numPieces
+	}
+	return len(s.completed)
+}
+
+// Number of bytes currently buffered for pieces that are not complete yet.
+func (s *VirtualStorage) BufferedBytes() (n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, buf := range s.buffers {
+		n += int64(len(buf))
+	}
+	return
+}
+
+func (p virtualPiece) ReadAt(b []byte, off int64) (n int, err error) {
+	if off >= p.piece.Length() {
+		return 0, io.EOF
+	}
+	if remaining := p.piece.Length() - off; int64(len(b)) > remaining {
+		b = b[:remaining]
+		err = io.EOF
+	}
+	p.s.mu.Lock()
+	buf, buffered := p.s.buffers[p.piece.Index()]
+	complete := p.s.complete || p.s.completed[p.piece.Index()]
+	p.s.mu.Unlock()
+	if complete {
+		n = p.s.cache.read(b, p.piece.Offset()+off)
+		return
+	}
+	if !buffered {
+		return 0, io.ErrUnexpectedEOF
+	}
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	n = copy(b, buf[off:])
+	return
+}
+
+func (p virtualPiece) WriteAt(b []byte, off int64) (n int, err error) {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	if p.s.complete || p.s.completed[p.piece.Index()] {
+		return len(b), nil
+	}
+	buf, ok := p.s.buffers[p.piece.Index()]
+	if !ok {
+		buf = make([]byte, p.piece.Length())
+		p.s.buffers[p.piece.Index()] = buf
+	}
+	return copy(buf[off:], b), nil
+}
+
+// Read the content at the given offset through the cache.
+func (c *blockCache) read(b []byte, off int64) (n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n < len(b) {
+		index := (off + int64(n)) / contentBlockSize
+		block, ok := c.blocks[index]
+		if !ok {
+			block = make([]byte, contentBlockSize)
+			c.content.block(index, block)
+			if len(c.order) == virtualCacheBlocks {
+				delete(c.blocks, c.order[0])
+				c.order = c.order[1:]
+			}
+			c.blocks[index] = block
+			c.order = append(c.order, index)
+		}
+		n += copy(b[n:], block[(off+int64(n))%contentBlockSize:])
+	}
+	return
+}
+
+// Called once the piece passed its hash check, so its buffer can be dropped (after making sure it matches the content).
+func (p virtualPiece) MarkComplete() error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	if buf, ok := p.s.buffers[p.piece.Index()]; ok {
+		want := make([]byte, len(buf))
+		p.s.content.ReadAt(want, p.piece.Offset())
+		if !bytes.Equal(want, buf) {
+			p.s.mismatched = append(p.s.mismatched, p.piece.Index())
+		}
+	}
+	delete(p.s.buffers, p.piece.Index())
+	p.s.completed[p.piece.Index()] = true
+	return nil
+}
+
+func (p virtualPiece) MarkNotComplete() error {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	delete(p.s.completed, p.piece.Index())
+	return nil
+}
+
+func (p virtualPiece) Completion() storage.Completion {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	return storage.Completion{Complete: p.s.complete || p.s.completed[p.piece.Index()], Ok: true}
+}
+
+// Create the metaInfo of a single test file holding the given content, with the given piece length,
+// without writing it anywhere.
+func CreateVirtualMetaInfo(t *testing.T, name string, content Content, pieceLength int64, trackers [][]string) (metaInfo metainfo.MetaInfo) {
+	metaInfo = metainfo.MetaInfo{AnnounceList: trackers}
+	metaInfo.SetDefaults()
+	info := metainfo.Info{Name: name, Length: content.Size, PieceLength: pieceLength}
+	err := info.GeneratePieces(func(metainfo.FileInfo) (io.ReadCloser, error) {
+		return io.NopCloser(content.Reader()), nil
+	})
+	require.NoError(t, err)
+	metaInfo.InfoBytes, err = bencode.Marshal(info)
+	require.NoError(t, err)
+	return
+}
+
+// Check that each virtual storage completed every piece of its torrent (each of them having passed its hash check
+// against the metainfo), and holds no leftover data.
+func VerifyVirtualContent(t *testing.T, storages []*VirtualStorage) {
+	fmt.Println("Verifying virtual content completion")
+	for i, s := range storages {
+		s.mu.Lock()
+		numPieces, mismatched := s.numPieces, s.mismatched
+		s.mu.Unlock()
+		require.NotZero(t, numPieces, "storage %d has no torrent", i)
+		require.Empty(t, mismatched, "pieces of storage %d not matching the content of seed %d", i, s.content.Seed)
+		require.Equal(t, numPieces, s.NumCompleted(), "pieces completed by storage %d", i)
+		require.Zero(t, s.BufferedBytes(), "bytes left buffered by storage %d", i)
+	}
+	fmt.Println("SUCCESS: Virtual content complete and verified")
+}
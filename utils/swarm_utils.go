@@ -0,0 +1,613 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"rbtValidation/tracker"
+	"sync"
+	"testing"
+	"time"
+
+	rbt "github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// How long a trusted baseline provider may take to be promoted by the tracker.
+	promotionTimeout = 10 * time.Second
+	// How long a closing peer waits for the tracker to receive its stopped announce.
+	stopTimeout = 5 * time.Second
+)
+
+// The role a peer plays within a swarm.
+type Role int
+
+const (
+	Seeder Role = iota
+	BaselineProvider
+	Leecher
+)
+
+func (r Role) String() string {
+	switch r {
+	case Seeder:
+		return "seeder"
+	case BaselineProvider:
+		return "baseline provider"
+	case Leecher:
+		return "leecher"
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// The name of the role as in scenarios and reports (e.g. "baseline_provider"), see ParseRole.
+func (r Role) Name() string {
+	switch r {
+	case Seeder:
+		return "seeder"
+	case BaselineProvider:
+		return "baseline_provider"
+	case Leecher:
+		return "leecher"
+	}
+	return fmt.Sprintf("role%d", int(r))
+}
+
+// Declaration of a swarm sharing a single test file.
+type SwarmConfig struct {
+	// Size of the test file shared by the swarm.
+	FileSize int64
+	// Piece length of the torrent, PieceLength if zero.
+	PieceLength int64
+	// Number of seeders, each starting with the complete file.
+	Seeders int
+	// Listen ports of the first seeders, in order. A seeder without one, or with a zero one, listens on any free port.
+	SeederPorts []int
+	// Listen ports of the baseline providers (one for each port), each starting with the complete file.
+	// All of them are trusted by the tracker. A zero port is replaced by a free one, see FreePort.
+	BaselineProviderPorts []int
+	// Listen ports of fake baseline providers (one for each port), which are set up like any baseline provider but
+	// are not trusted by the tracker. A zero port is replaced by a free one.
+	FakeBaselineProviderPorts []int
+	// Number of leechers, each starting empty.
+	Leechers int
+	// Listen ports of the first leechers, in order. A leecher without one, or with a zero one, listens on any free port.
+	LeecherPorts []int
+	// Do not start a tracker, peers then have to be connected by hand (see Swarm.Connect).
+	NoTracker bool
+	// Route every connection between peers through a link of a loopback proxy network, where faults can be injected
+	// (see Swarm.Link). Peer exchange and uTP are disabled, so peers only learn about each other's links.
+	Proxied bool
+	// Share a directory tree of these files (named TestDirName) instead of a single test file of FileSize bytes.
+	Files []TreeFile
+	// Keep the test file in a VirtualStorage rather than on disk, so large files do not need a copy per peer.
+	// Content is then checked with VerifyVirtualContent instead of VerifyPieces.
+	Virtual bool
+	// Called on each peer before its client is created, to tweak its configuration (e.g. rate limiters).
+	Configure func(p *Peer)
+	// Have the tracker trust baseline providers by key alone (see tracker.Config.RequireIdentity): each baseline
+	// provider it would trust by port gets an identity registered under its name instead, and announces through a
+	// signing proxy (see Peer.Signer).
+	SignedBaselineProviders bool
+	// Have the tracker drop peers that have not announced for this long (see tracker.Config.PeerTimeout), so a dead
+	// baseline provider gets replaced by another one (the tracker ignores its unsigned stopped announce). Never if zero.
+	TrackerPeerTimeout time.Duration
+	// Let the client announce as often as the tracker asks (see Torrent.SmallIntervalAllowed) rather than at most once
+	// a minute, so the tracker sees the swarm change within seconds.
+	SmallInterval bool
+	// Start the leechers only once the tracker promoted a baseline provider, so they learn about it on their first
+	// announce. Needs a tracker and a trusted baseline provider.
+	WaitPromoted bool
+}
+
+// A peer of a swarm.
+type Peer struct {
+	Role    Role
+	ID      int
+	Config  *rbt.ClientConfig
+	Client  *rbt.Client
+	Torrent *rbt.Torrent
+	// Storage of the peer in a virtual swarm, nil otherwise
+	Storage *VirtualStorage
+	// Storage corrupting what the peer serves, nil for an honest peer (see Swarm.AddCorruptingPeer)
+	Corrupting *CorruptingStorage
+	// Proxy signing the announces of a baseline provider with its identity, nil unless SwarmConfig.SignedBaselineProviders
+	Signer *tracker.SigningProxy
+	// For a baseline provider joining the running swarm, keep the tracker from trusting it (set by a configure hook)
+	Untrusted bool
+
+	// Tracker of the swarm the peer announces to, nil if none
+	tracker   *tracker.Tracker
+	closeOnce sync.Once
+}
+
+func (p *Peer) String() string {
+	return fmt.Sprintf("%s %d", p.Role, p.ID)
+}
+
+// Close the peer gracefully, which can be done at most once (later calls are ignored): its torrent is dropped first, so
+// it sends its trackers a stopped announce (a closed client sends none), and its client is closed once the tracker of
+// the swarm received the announce.
+func (p *Peer) Close() {
+	p.closeOnce.Do(func() {
+		if p.Torrent != nil {
+			p.Torrent.Drop()
+			p.waitStopped()
+		}
+		p.Client.Close()
+	})
+}
+
+// Wait until the tracker of the swarm received the stopped announce of the peer, if it ever heard from the peer.
+// Gives up after stopTimeout, as a peer cut off from the tracker never gets its announce through.
+func (p *Peer) waitStopped() {
+	if p.tracker == nil {
+		return
+	}
+	infoHash, peerID := p.Torrent.InfoHash(), [20]byte(p.Client.PeerID())
+	for deadline := time.Now().Add(stopTimeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		announcements := p.tracker.Recorder.ByPeerID(infoHash)[peerID]
+		if len(announcements) == 0 || announcements[len(announcements)-1].Event == "stopped" {
+			return
+		}
+	}
+}
+
+// A set of peers sharing a single test file, with an optional tracker.
+// Everything is torn down when the test finishes.
+type Swarm struct {
+	t      *testing.T
+	config SwarmConfig
+
+	Tracker  *tracker.Tracker
+	Network  *Network
+	MetaInfo metainfo.MetaInfo
+	// Content of the test file
+	Content Content
+	// Transfer metrics of every peer, once started (see Swarm.StartMetrics)
+	Metrics *Metrics
+	// Where the data received by each peer came from, peers are named as by Peer.String
+	Ledger *Ledger
+	peers  map[Role][]*Peer
+}
+
+// Create a swarm as declared by the config: start the tracker, create the test file within the dir of every seeder and
+// baseline provider, and add the torrent to every peer. Downloads are not started, see Swarm.DownloadAll.
+func NewSwarm(t *testing.T, config SwarmConfig) (s *Swarm) {
+	// The tracker trusts baseline providers by port, so they need theirs before it starts
+	config.BaselineProviderPorts = allocatePorts(t, config.BaselineProviderPorts)
+	config.FakeBaselineProviderPorts = allocatePorts(t, config.FakeBaselineProviderPorts)
+	s = &Swarm{t: t, config: config, Content: TestContent(t, config.FileSize), Ledger: NewLedger(), peers: make(map[Role][]*Peer)}
+
+	trackers := [][]string{}
+	if !config.NoTracker {
+		s.Tracker = StartTrackerWithConfig(t, tracker.Config{
+			TrustedPorts:    config.BaselineProviderPorts,
+			RequireIdentity: config.SignedBaselineProviders,
+			PeerTimeout:     config.TrackerPeerTimeout,
+		})
+		trackers = [][]string{{s.Tracker.AnnounceURL()}}
+	}
+	if config.Proxied {
+		s.Network = NewNetwork(TestSeed(t))
+		t.Cleanup(s.Network.Close)
+		if s.Tracker != nil {
+			s.Tracker.SetAddrMapper(s.mapAddr)
+		}
+	}
+
+	// Declare every peer first, so the test file can be created for all complete ones at once
+	for i := 0; i < config.Seeders; i++ {
+		s.declarePeer(Seeder, portAt(config.SeederPorts, i))
+	}
+	for _, port := range config.BaselineProviderPorts {
+		s.declarePeer(BaselineProvider, port)
+	}
+	for _, port := range config.FakeBaselineProviderPorts {
+		s.declarePeer(BaselineProvider, port)
+	}
+	for i := 0; i < config.Leechers; i++ {
+		s.declarePeer(Leecher, portAt(config.LeecherPorts, i))
+	}
+
+	completeDirs := s.DataDirs(Seeder, BaselineProvider)
+	require.NotZero(t, len(completeDirs), "a swarm needs at least one seeder or baseline provider")
+	pieceLength := config.PieceLength
+	if pieceLength == 0 {
+		pieceLength = PieceLength
+	}
+	if len(config.Files) != 0 {
+		require.False(t, config.Virtual, "a virtual swarm only shares a single file")
+		CreateTree(t, completeDirs, TestDirName, config.Files)
+		s.MetaInfo = CreatePieceLengthMetaInfo(t, filepath.Join(completeDirs[0], TestDirName), pieceLength, trackers)
+	} else if config.Virtual {
+		s.MetaInfo = CreateVirtualMetaInfo(t, TestFileName, s.Content, pieceLength, trackers)
+	} else {
+		CreateFilesInDirs(t, completeDirs, TestFileName, config.FileSize)
+		s.MetaInfo = CreatePieceLengthMetaInfo(t, filepath.Join(completeDirs[0], TestFileName), pieceLength, trackers)
+	}
+
+	for _, role := range []Role{Seeder, BaselineProvider} {
+		for _, p := range s.peers[role] {
+			s.startPeer(p, &s.MetaInfo)
+		}
+	}
+	if config.WaitPromoted {
+		require.NotNil(t, s.Tracker, "waiting for a promotion needs a tracker")
+		s.WaitPromoted()
+	}
+	for _, p := range s.peers[Leecher] {
+		s.startPeer(p, &s.MetaInfo)
+	}
+	return
+}
+
+// Wait until the tracker promotes a baseline provider for the swarm's torrent, and return its listen port.
+// Fails if none is promoted within a few announce intervals.
+func (s *Swarm) WaitPromoted() (port int) {
+	infoHash := s.MetaInfo.HashInfoBytes()
+	require.Eventually(s.t, func() bool {
+		bp, ok := s.Tracker.BaselineProvider(infoHash)
+		port = bp.Port
+		return ok
+	}, promotionTimeout, promotionTimeout/100, "no baseline provider promoted")
+	return
+}
+
+// Add another peer with the given role and listen port to the running swarm.
+// A seeder or baseline provider joins with a copy of the complete file.
+// A baseline provider joining is trusted by the tracker, and gets a free port if the given one is zero.
+func (s *Swarm) AddPeer(role Role, listenPort int) (p *Peer) {
+	return s.addPeer(role, listenPort, &s.MetaInfo, nil)
+}
+
+// Add another peer like AddPeer, but without telling it about the tracker. See Swarm.AddTrackers.
+func (s *Swarm) AddTrackerlessPeer(role Role, listenPort int) (p *Peer) {
+	return s.addPeer(role, listenPort, s.trackerlessMetaInfo(), nil)
+}
+
+// A copy of the metainfo of the swarm without any tracker.
+func (s *Swarm) trackerlessMetaInfo() *metainfo.MetaInfo {
+	trackerlessMetaInfo := s.MetaInfo
+	trackerlessMetaInfo.Announce = ""
+	trackerlessMetaInfo.AnnounceList = [][]string{}
+	return &trackerlessMetaInfo
+}
+
+// Tell a peer about the tracker of the swarm (if any), through its signing proxy if it has one.
+func (s *Swarm) AddTrackers(p *Peer) {
+	if p.Signer != nil {
+		p.Torrent.AddTrackers([][]string{{p.Signer.AnnounceURL()}})
+		return
+	}
+	p.Torrent.AddTrackers(s.MetaInfo.AnnounceList)
+}
+
+// Let the given peer know about another peer directly, without going through the tracker.
+func (s *Swarm) Connect(from *Peer, to *Peer) {
+	if s.Network == nil {
+		from.Torrent.AddClientPeer(to.Client)
+		return
+	}
+	from.Torrent.AddPeers([]rbt.PeerInfo{{Addr: s.Link(from, to).Addr(), Trusted: true}})
+}
+
+// The link of the proxy network that the first peer goes through to reach the second one.
+// Only available if the swarm is proxied.
+func (s *Swarm) Link(from *Peer, to *Peer) *Link {
+	require.NotNil(s.t, s.Network, "swarm is not proxied")
+	l, err := s.Network.Link(from.Client.LocalPort(), to.Client.LocalPort())
+	require.NoError(s.t, err)
+	return l
+}
+
+// Set the faults of the links between two peers, whichever of them dials the other.
+func (s *Swarm) SetLinkFaults(a *Peer, b *Peer, faults LinkFaults) {
+	s.Link(a, b).Set(faults)
+	s.Link(b, a).Set(faults)
+}
+
+// Reset the connections open between two peers, whichever of them dialed the other.
+func (s *Swarm) ResetLinks(a *Peer, b *Peer) {
+	s.Link(a, b).Reset()
+	s.Link(b, a).Reset()
+}
+
+// Split the peers into groups that cannot reach each other, see Network.Partition.
+func (s *Swarm) Partition(groups ...[]*Peer) {
+	require.NotNil(s.t, s.Network, "swarm is not proxied")
+	portGroups := make([][]int, len(groups))
+	for i, group := range groups {
+		for _, p := range group {
+			portGroups[i] = append(portGroups[i], p.Client.LocalPort())
+		}
+	}
+	s.Network.Partition(portGroups...)
+}
+
+// Make the tracker unreachable for the given peers, see tracker.Tracker.Block.
+func (s *Swarm) CutTracker(peers ...*Peer) {
+	for _, p := range peers {
+		s.Tracker.Block(p.Client.LocalPort())
+	}
+}
+
+// Crash a peer abruptly, as a power loss would, rather than closing it cleanly: every link from or to it goes down for
+// good (its connections are black-holed, no FIN or RST reaches the others) and the tracker stops hearing from it
+// (not even an announce already on its way gets through), only then is its client closed, without dropping its torrent
+// first, so unlike Peer.Close it sends no stopped announce. Only available if the swarm is proxied.
+func (s *Swarm) Crash(p *Peer) {
+	require.NotNil(s.t, s.Network, "swarm is not proxied")
+	port := p.Client.LocalPort()
+	s.Network.Isolate(port)
+	if s.Tracker != nil {
+		s.Tracker.Block(port)
+	}
+	fmt.Printf("Crashing %s\n", p)
+	p.closeOnce.Do(func() { p.Client.Close() })
+}
+
+// Undo any partition, and make the tracker reachable for everyone again.
+func (s *Swarm) Heal() {
+	if s.Network != nil {
+		s.Network.Heal()
+	}
+	if s.Tracker != nil {
+		s.Tracker.Unblock()
+	}
+}
+
+// The address the tracker hands out to a peer for another one: the link from the first to the other if the swarm is
+// proxied, the address the other listens on otherwise.
+func (s *Swarm) Addr(of *Peer, peer *Peer) (net.IP, int) {
+	if s.Network != nil {
+		if l, err := s.Network.Link(of.Client.LocalPort(), peer.Client.LocalPort()); err == nil {
+			return l.Addr().IP, l.Addr().Port
+		}
+	}
+	return s.IP(peer), peer.Client.LocalPort()
+}
+
+// Whether the peer takes the other one for its baseline provider, as known by the address the tracker hands out for it.
+func (s *Swarm) TakesForBaselineProvider(p *Peer, bp *Peer) bool {
+	bpIP, bpPort := p.Torrent.GetBaselineProvider()
+	ip, port := s.Addr(p, bp)
+	return bpIP.Equal(ip) && bpPort == port
+}
+
+// Hand out the link towards a peer instead of its own address, keeping the address as is if no link can be made.
+func (s *Swarm) mapAddr(to tracker.Peer, peer tracker.Peer) (net.IP, int) {
+	l, err := s.Network.Link(to.Port, peer.Port)
+	if err != nil {
+		return peer.IP, peer.Port
+	}
+	return l.Addr().IP, l.Addr().Port
+}
+
+// Start downloading the test file on every leecher.
+func (s *Swarm) DownloadAll() {
+	for _, p := range s.peers[Leecher] {
+		p.Torrent.DownloadAll()
+	}
+}
+
+// Wait until every leecher has completed its download.
+func (s *Swarm) WaitLeechers() {
+	for _, p := range s.peers[Leecher] {
+		p.Client.WaitAll()
+	}
+}
+
+// Wait until every leecher has completed its download within the given bound from now, and return how long each of
+// them took since the given time. Fails with the number of leechers still incomplete once the bound is over.
+func (s *Swarm) WaitCompletionTimes(since time.Time, within time.Duration) []time.Duration {
+	leechers := s.Peers(Leecher)
+	times := make([]time.Duration, len(leechers))
+	done := make(chan struct{}, len(leechers))
+	stop := make(chan struct{})
+	defer close(stop)
+	for i, p := range leechers {
+		go func(i int, p *Peer) {
+			select {
+			case <-p.Torrent.Complete.On():
+				times[i] = time.Since(since)
+				done <- struct{}{}
+			case <-stop:
+			}
+		}(i, p)
+	}
+	timeout := time.After(within)
+	for completed := 0; completed < len(leechers); completed++ {
+		select {
+		case <-done:
+		case <-timeout:
+			require.FailNow(s.t, "leechers did not complete", "%d of %d leechers still incomplete after %v",
+				len(leechers)-completed, len(leechers), within)
+		}
+	}
+	return times
+}
+
+// The i-th seeder.
+func (s *Swarm) Seeder(i int) *Peer {
+	return s.peers[Seeder][i]
+}
+
+// The i-th baseline provider.
+func (s *Swarm) BaselineProvider(i int) *Peer {
+	return s.peers[BaselineProvider][i]
+}
+
+// The i-th leecher.
+func (s *Swarm) Leecher(i int) *Peer {
+	return s.peers[Leecher][i]
+}
+
+// All peers with any of the given roles, in the order they were added.
+func (s *Swarm) Peers(roles ...Role) (peers []*Peer) {
+	for _, role := range roles {
+		peers = append(peers, s.peers[role]...)
+	}
+	return
+}
+
+// The clients of all peers with any of the given roles.
+func (s *Swarm) Clients(roles ...Role) (clients []*rbt.Client) {
+	for _, p := range s.Peers(roles...) {
+		clients = append(clients, p.Client)
+	}
+	return
+}
+
+// The torrents of all peers with any of the given roles.
+func (s *Swarm) Torrents(roles ...Role) (torrents []*rbt.Torrent) {
+	for _, p := range s.Peers(roles...) {
+		torrents = append(torrents, p.Torrent)
+	}
+	return
+}
+
+// Start sampling the transfer metrics of every peer at the given interval, including peers added later.
+// Each peer is tracked under its name (e.g. "leecher 0").
+func (s *Swarm) StartMetrics(interval time.Duration) *Metrics {
+	s.Metrics = StartMetrics(s.t, interval)
+	for _, p := range s.Peers(Seeder, BaselineProvider, Leecher) {
+		s.Metrics.Track(p.String(), p.Torrent)
+	}
+	return s.Metrics
+}
+
+// The virtual storages of all peers with any of the given roles, see SwarmConfig.Virtual.
+func (s *Swarm) Storages(roles ...Role) (storages []*VirtualStorage) {
+	for _, p := range s.Peers(roles...) {
+		storages = append(storages, p.Storage)
+	}
+	return
+}
+
+// The data directories of all peers with any of the given roles.
+func (s *Swarm) DataDirs(roles ...Role) (dirs []string) {
+	for _, p := range s.Peers(roles...) {
+		dirs = append(dirs, p.Config.DataDir)
+	}
+	return
+}
+
+// Create the configuration and data directory of a peer, without starting its client.
+func (s *Swarm) declarePeer(role Role, listenPort int) (p *Peer) {
+	p = &Peer{Role: role, ID: len(s.peers[role])}
+	switch role {
+	case Seeder:
+		p.Config = SeederConfig(s.t, p.ID, listenPort)
+	case BaselineProvider:
+		p.Config = BaselineProviderConfig(s.t, p.ID, listenPort)
+	case Leecher:
+		p.Config = LeecherConfig(s.t, p.ID, listenPort)
+	}
+	if s.config.Proxied {
+		p.Config.DisablePEX = true
+		p.Config.DisableUTP = true
+	}
+	if s.config.Configure != nil {
+		s.config.Configure(p)
+	}
+	if s.config.Virtual {
+		p.Storage = NewVirtualStorage(s.Content, role != Leecher)
+		// Every peer serves the same content, one cache is enough
+		if storages := s.Storages(Seeder, BaselineProvider, Leecher); len(storages) != 0 {
+			p.Storage.ShareCache(storages[0])
+		}
+		p.Config.DefaultStorage = p.Storage
+	}
+	s.Ledger.Install(p.String(), p.Config)
+	CreateDir(s.t, p.Config.DataDir)
+	s.peers[role] = append(s.peers[role], p)
+	return
+}
+
+// Add a peer to the running swarm, calling configure (if any) on it before its client is created.
+func (s *Swarm) addPeer(role Role, listenPort int, metaInfo *metainfo.MetaInfo, configure func(p *Peer)) (p *Peer) {
+	completeDir := s.DataDirs(Seeder, BaselineProvider)[0]
+	if role == BaselineProvider && listenPort == 0 {
+		listenPort = FreePort(s.t)
+	}
+	p = s.declarePeer(role, listenPort)
+	if configure != nil {
+		configure(p)
+	}
+	if role != Leecher && len(s.config.Files) != 0 {
+		CopyTree(s.t, completeDir, p.Config.DataDir, TestDirName)
+	} else if role != Leecher && !s.config.Virtual {
+		CopyFile(s.t, filepath.Join(completeDir, TestFileName), filepath.Join(p.Config.DataDir, TestFileName))
+	}
+	if role == BaselineProvider && s.Tracker != nil && !p.Untrusted {
+		s.Tracker.TrustPort(listenPort)
+	}
+	s.startPeer(p, metaInfo)
+	return
+}
+
+// Copy the ports, replacing every zero port by a free one.
+func allocatePorts(t *testing.T, ports []int) (allocated []int) {
+	for _, port := range ports {
+		if port == 0 {
+			port = FreePort(t)
+		}
+		allocated = append(allocated, port)
+	}
+	return
+}
+
+// The i-th of the ports, zero if there are fewer.
+func portAt(ports []int, i int) int {
+	if i < len(ports) {
+		return ports[i]
+	}
+	return 0
+}
+
+// Create the client of a peer and add the torrent of the given metainfo to it.
+func (s *Swarm) startPeer(p *Peer, metaInfo *metainfo.MetaInfo) {
+	metaInfo = s.sign(p, metaInfo)
+	var err error
+	p.Client, err = rbt.NewClient(p.Config)
+	require.NoError(s.t, err, "creating client of %s", p)
+	s.Ledger.Register(p.String(), p.Client)
+	p.tracker = s.Tracker
+	// Cleanups run last-in-first-out, so the client is closed before the data dir of the test is removed
+	s.t.Cleanup(p.Close)
+
+	p.Torrent, err = p.Client.AddTorrent(metaInfo)
+	require.NoError(s.t, err, "adding torrent to %s", p)
+	p.Torrent.SmallIntervalAllowed = s.config.SmallInterval
+	if s.Metrics != nil {
+		s.Metrics.Track(p.String(), p.Torrent)
+	}
+	if p.Role == Leecher {
+		<-p.Torrent.GotInfo()
+	} else {
+		TestSeederInitial(s.t, p.Torrent, err)
+	}
+}
+
+// Give a baseline provider trusted by the tracker an identity registered under its name, and have it announce through
+// a signing proxy, if the swarm signs baseline providers. Returns the metainfo the peer should use.
+func (s *Swarm) sign(p *Peer, metaInfo *metainfo.MetaInfo) *metainfo.MetaInfo {
+	if !s.config.SignedBaselineProviders || p.Role != BaselineProvider || s.Tracker == nil || !s.Tracker.IsTrusted(p.Config.ListenPort) {
+		return metaInfo
+	}
+	identity, err := tracker.NewIdentity()
+	require.NoError(s.t, err)
+	require.NoError(s.t, s.Tracker.Registry.Register(p.String(), identity.Public))
+	p.Signer, err = tracker.NewSigningProxy(s.Tracker.AnnounceURL(), identity)
+	require.NoError(s.t, err)
+	s.t.Cleanup(func() { p.Signer.Close() })
+	if len(metaInfo.AnnounceList) == 0 {
+		return metaInfo
+	}
+	signed := *metaInfo
+	signed.AnnounceList = [][]string{{p.Signer.AnnounceURL()}}
+	return &signed
+}
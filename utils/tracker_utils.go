@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"fmt"
+	"rbtValidation/tracker"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+// Number of consecutive regular announces needed from a peer to judge its announce cadence.
+const minCadenceAnnounces = 3
+
+// Start an in-process tracker for the duration of the test, with peers on the given ports trusted as baseline providers.
+// The tracker is closed (and its swarm state dropped) when the test finishes.
+func StartTracker(t *testing.T, trustedPorts ...int) *tracker.Tracker {
+	return StartTrackerWithConfig(t, tracker.Config{TrustedPorts: trustedPorts})
+}
+
+// Start an in-process tracker with the given configuration for the duration of the test, see StartTracker.
+func StartTrackerWithConfig(t *testing.T, config tracker.Config) *tracker.Tracker {
+	tr := tracker.New(config)
+	require.NoError(t, tr.Start())
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+// Log every announce the tracker recorded for the given info hash.
+func LogAnnounces(t *testing.T, tr *tracker.Tracker, infoHash metainfo.Hash) {
+	for _, a := range tr.Recorder.Announcements(infoHash) {
+		event := a.Event
+		if event == "" {
+			event = "-"
+		}
+		t.Logf("%s announce from %x on port %d: event=%s left=%d uploaded=%d downloaded=%d reliable=%t",
+			a.Time.Format("15:04:05.000"), a.ID, a.Port, event, a.Left, a.Uploaded, a.Downloaded, a.Reliable)
+	}
+}
+
+// Verify that each peer listening on the given ports announced the given info hash every interval: on average within
+// the tolerance, and never so late that an announce was skipped (a busy client may delay a single one).
+// Announces carrying an event are sent on top of the regular ones, so only the gaps between regular announces count.
+func VerifyAnnounceCadence(t *testing.T, tr *tracker.Tracker, infoHash metainfo.Hash, ports []int, interval time.Duration, tolerance time.Duration) {
+	byPort := tr.Recorder.ByPort(infoHash)
+	for _, port := range ports {
+		var regular []tracker.Announcement
+		for _, a := range byPort[port] {
+			if a.Event == "" {
+				regular = append(regular, a)
+			}
+		}
+		require.GreaterOrEqual(t, len(regular), minCadenceAnnounces, "too few regular announces from port %d", port)
+		for i := 1; i < len(regular); i++ {
+			gap := regular[i].Time.Sub(regular[i-1].Time)
+			require.Greater(t, gap, interval-tolerance, "announce %d from port %d came early, %v after the previous one", i, port, gap)
+			require.Less(t, gap, 2*interval, "announce %d from port %d came late, %v after the previous one", i, port, gap)
+		}
+		average := regular[len(regular)-1].Time.Sub(regular[0].Time) / time.Duration(len(regular)-1)
+		require.InDelta(t, interval, average, float64(tolerance), "peer on port %d announced every %v on average, expected %v", port, average, interval)
+	}
+	fmt.Println("SUCCESS: Each peer announced once per interval")
+}
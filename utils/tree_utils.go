@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+// A file within a test directory tree.
+type TreeFile struct {
+	// Slash-separated path relative to the root of the tree
+	Path string
+	Size int64
+}
+
+// A directory tree of files of varied sizes, laid out so that the torrent built from it (with the given piece length)
+// has empty files, files smaller than a piece, pieces spanning several files, and files spanning several pieces.
+// Files are listed in the order of the torrent.
+func VariedTree(pieceLength int64) []TreeFile {
+	return []TreeFile{
+		{"a/empty.txt", 0},
+		{"a/small.txt", 1000},
+		{"a/straddling.txt", pieceLength},
+		{"b/c/d/deep.txt", pieceLength/2 + 1},
+		{"b/c/empty.txt", 0},
+		{"b/large.txt", 3*pieceLength + 7},
+		{"b/tiny.txt", 1},
+		{"top.txt", pieceLength - 1},
+	}
+}
+
+// Total size of the files of a tree.
+func TreeSize(files []TreeFile) (size int64) {
+	for _, f := range files {
+		size += f.Size
+	}
+	return
+}
+
+// The content of the i-th file of a tree, each file getting its own seed derived from the test seed,
+// so no two files share their data.
+func treeFileContent(t *testing.T, i int, f TreeFile) Content {
+	return Content{Seed: TestSeed(t) + int64(i+1)*1_000_003, Size: f.Size}
+}
+
+// Create the given directory tree, rooted at <dir>/<name>, within each directory.
+// Fails if any file IO fails or no directory is given.
+func CreateTree(t *testing.T, dirs []string, name string, files []TreeFile) {
+	require.NotZero(t, len(dirs))
+	for i, f := range files {
+		paths := make([]string, len(dirs))
+		for j, dir := range dirs {
+			paths[j] = filepath.Join(dir, name, filepath.FromSlash(f.Path))
+		}
+		CreateContentFiles(t, paths, treeFileContent(t, i, f))
+	}
+}
+
+// Create the metaInfo of the directory tree rooted at <dir>/<name>, to be added to any client.
+func CreateTreeMetaInfo(t *testing.T, dir string, name string, trackers [][]string) (metaInfo metainfo.MetaInfo) {
+	metaInfo = CreatePieceLengthMetaInfo(t, filepath.Join(dir, name), PieceLength, trackers)
+	info, err := metaInfo.UnmarshalInfo()
+	require.NoError(t, err)
+	require.True(t, info.IsDir(), "%s is not a directory", name)
+	return
+}
+
+// Copy the directory tree rooted at <srcDir>/<name> to <dstDir>/<name>.
+// Fails if any file IO fails.
+func CopyTree(t *testing.T, srcDir string, dstDir string, name string) {
+	root := filepath.Join(srcDir, name)
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		CopyFile(t, p, filepath.Join(dstDir, rel))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+// Check that the directory tree rooted at <dir>/<name> within each directory holds exactly the given files,
+// each with the content it was created with (see CreateTree).
+// Fails with the first file, and offset within it, that does not match.
+func VerifyTree(t *testing.T, name string, files []TreeFile, checkDirs []string) {
+	fmt.Println("Verifying directory tree content")
+	for _, dir := range checkDirs {
+		expected := make(map[string]bool)
+		for i, f := range files {
+			p := filepath.Join(dir, name, filepath.FromSlash(f.Path))
+			expected[p] = true
+			VerifyContent(t, p, treeFileContent(t, i, f))
+		}
+		// No other file should have shown up
+		err := filepath.Walk(filepath.Join(dir, name), func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			if !expected[p] {
+				rel, _ := filepath.Rel(filepath.Join(dir, name), p)
+				return fmt.Errorf("unexpected file %s", path.Clean(filepath.ToSlash(rel)))
+			}
+			return nil
+		})
+		require.NoError(t, err, "tree of %s", dir)
+	}
+	fmt.Println("SUCCESS: Directory tree content holds")
+}